@@ -3,45 +3,88 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"code.siemens.com/energy-community-controller/common"
 	"code.siemens.com/energy-community-controller/controller"
 	"code.siemens.com/energy-community-controller/dda"
 	"code.siemens.com/energy-community-controller/mqtt"
+	"code.siemens.com/energy-community-controller/ocpp"
+	"code.siemens.com/energy-community-controller/registration"
 	"github.com/coatyio/dda/services/com/api"
 	"github.com/google/uuid"
 )
 
+// chargerDevice is the wallbox, reached by MQTT or as OCPP charge point.
+type chargerDevice interface {
+	PublishChargingSetPoint(ctx context.Context, chargingSetPoint float64) error
+	SubscribeToChargerStatus(ctx context.Context) (<-chan common.ChargerStatus, error)
+}
+
 func main() {
 	log.Println("starting charger")
 
+	cfg := common.NewConfig()
+
 	var id string
 	var url string
 	var energyCommunityId string
 	var sensorId string
 	bootstrap := flag.Bool("b", false, "bootstrap raft")
 	leadershipElectionEnabled := flag.Bool("l", false, "participate in leader election")
+	leadershipObserved := flag.Bool("o", false, "observe the leader election without participating")
+	dataDir := flag.String("data", "", "directory for the raft log and snapshots, the replicated state is not persisted if empty")
+	leaderPriority := flag.Int("priority", 0, "leader election priority, nodes with a higher priority are preferred as leader")
 	flag.StringVar(&id, "id", uuid.NewString(), "id")
 	flag.StringVar(&url, "url", "tcp://localhost:1883", "mqtt url")
 	flag.StringVar(&energyCommunityId, "energyCommunityId", "energyCommunity", "energy community id")
 	flag.StringVar(&sensorId, "sensorId", "sensor", "sensor id")
+	mqttMapping := flag.String("mqttMapping", "", "JSON file with MQTT topic templates and payload mappings")
+	flag.StringVar(&cfg.Auth.CaFile, "ca", "", "CA certificate file to verify the MQTT broker (env MQTT_CA_FILE)")
+	flag.StringVar(&cfg.Auth.CertFile, "cert", "", "client certificate file (env MQTT_CERT_FILE)")
+	flag.StringVar(&cfg.Auth.KeyFile, "key", "", "client key file (env MQTT_KEY_FILE)")
+	flag.StringVar(&cfg.Auth.Username, "username", "", "MQTT username (env MQTT_USERNAME)")
+	flag.StringVar(&cfg.Auth.PasswordFile, "passwordFile", "", "file containing the MQTT password (env MQTT_PASSWORD_FILE or MQTT_PASSWORD)")
+	flag.StringVar(&cfg.Auth.MembershipSecretFile, "membershipSecretFile", "", "file containing the secret of raft membership requests (env MEMBERSHIP_SECRET_FILE or MEMBERSHIP_SECRET)")
+	flag.BoolVar(&cfg.Mqtt.Discovery.Enabled, "homeassistant", false, "publish Home Assistant MQTT discovery configs")
+	flag.StringVar(&cfg.Ocpp.ListenAddress, "ocpp", "", "listen address of the OCPP 1.6J central system, e.g. :9000, the MQTT device topics are used if empty")
+	flag.DurationVar(&cfg.Mqtt.SessionExpiryInterval, "sessionExpiry", 0, "keep the MQTT session on the broker for this time after a disconnect, e.g. 1h, a clean session is started if 0")
+	tags := flag.String("tags", "", "comma separated key=value tags sent on registration")
 	flag.Parse()
 
-	cfg := common.NewConfig()
 	cfg.Name = "charger"
 	cfg.Url = url
 	cfg.Id = id
 	cfg.EnergyCommunityId = energyCommunityId
+	cfg.Tags = common.ParseTags(*tags)
 	cfg.Leader.Enabled = *leadershipElectionEnabled
+	cfg.Leader.Observe = *leadershipObserved
 	cfg.Leader.Bootstrap = *bootstrap
+	cfg.Leader.Priority = *leaderPriority
+	cfg.Leader.DataDir = *dataDir
+
+	if err := cfg.Auth.Resolve(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if *mqttMapping != "" {
+		if err := mqtt.LoadMapping(*mqttMapping, &cfg.Mqtt); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
 	var ddaConnector *dda.Connector
+	var ctrl *controller.Controller
+	var registrationClient *registration.Client
 	var mqttConnector *mqtt.Connector
+	var centralSystem *ocpp.CentralSystem
+	var device chargerDevice
 	var err error
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -49,13 +92,36 @@ func main() {
 	defer func() {
 		log.Println("charger - shutting down")
 
-		deregister(ctx, ddaConnector, cfg)
+		// the leadership is handed over when the DDA connector is closed,
+		// the current allocation round is finished before
+		if ctrl != nil {
+			stopCtx, stopCancel := context.WithTimeout(ctx, cfg.Controller.Periode)
+			if err := ctrl.Stop(stopCtx); err != nil {
+				log.Printf("charger - could not finish the allocation round: %s", err)
+			}
+			stopCancel()
+		}
+
+		if registrationClient != nil {
+			deregisterCtx, deregisterCancel := context.WithTimeout(ctx, cfg.Registration.ShutdownTimeout)
+			if err := registrationClient.Deregister(deregisterCtx); err != nil {
+				log.Printf("charger - could not deregister node: %s", err)
+			} else if mqttConnector != nil {
+				mqttConnector.SetRegistered(deregisterCtx, false)
+			}
+			deregisterCancel()
+		}
+
 		cancel()
 
 		if ddaConnector != nil {
 			ddaConnector.Close()
 		}
 
+		if centralSystem != nil {
+			centralSystem.Close()
+		}
+
 		if mqttConnector != nil {
 			mqttConnector.Close()
 		}
@@ -70,12 +136,11 @@ func main() {
 	}
 
 	if cfg.Leader.Enabled {
-		if controller, err := controller.NewController(cfg.Controller, ddaConnector); err != nil {
+		if ctrl, err = controller.NewController(cfg.Controller, ddaConnector); err != nil {
+			log.Fatalln(err)
+		}
+		if err := ctrl.Start(ctx); err != nil {
 			log.Fatalln(err)
-		} else {
-			if err := controller.Start(ctx); err != nil {
-				log.Fatalln(err)
-			}
 		}
 	}
 
@@ -87,7 +152,72 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	register(ctx, ddaConnector, cfg)
+	device = mqttConnector
+	if cfg.Ocpp.ListenAddress != "" {
+		centralSystem = ocpp.NewCentralSystem(cfg.Ocpp)
+		if err = centralSystem.Open(); err != nil {
+			log.Fatalln(err)
+		}
+		device = centralSystem
+	}
+
+	capabilities := []string{common.CAPABILITY_CHARGING_SET_POINT}
+	if cfg.Mqtt.Discovery.Enabled {
+		if err := mqttConnector.PublishDiscovery(ctx, capabilities); err != nil {
+			log.Printf("charger - could not publish Home Assistant discovery: %s", err)
+		}
+	}
+
+	if ctrl != nil {
+		go func() {
+			for {
+				select {
+				case strategy := <-mqttConnector.AllocationStrategyCh():
+					if err := ctrl.SetAllocationStrategy(strategy); err != nil {
+						log.Printf("charger - could not change allocation strategy: %s", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	registrationClient = registration.NewClient(cfg.Registration, ddaConnector, common.DdaRegisterMessage{
+		NodeId:       cfg.Id,
+		SensorId:     cfg.SensorId,
+		NodeType:     common.NODE_TYPE_CHARGER,
+		Version:      common.Version,
+		Capabilities: capabilities,
+		Tags:         cfg.Tags,
+		LeaseTimeout: cfg.Lease.Timeout.Milliseconds(),
+	})
+	if err := registrationClient.Register(ctx); err != nil {
+		log.Fatalln(err)
+	}
+	if err := mqttConnector.SetRegistered(ctx, true); err != nil {
+		log.Printf("charger - could not publish status: %s", err)
+	}
+
+	go func() {
+		for isLeader := range ddaConnector.LeaderCh(ctx) {
+			if err := mqttConnector.SetLeader(ctx, isLeader); err != nil {
+				log.Printf("charger - could not publish status: %s", err)
+			}
+		}
+	}()
+
+	// the renewals are stopped before the node deregisters
+	leaseCtx, leaseCancel := context.WithCancel(ctx)
+	leaseDone := make(chan struct{})
+	go func() {
+		registrationClient.RenewLeases(leaseCtx, cfg.Lease)
+		close(leaseDone)
+	}()
+	defer func() {
+		leaseCancel()
+		<-leaseDone
+	}()
 
 	getChargerChannel, err := ddaConnector.SubscribeAction(ctx, api.SubscriptionFilter{Type: common.CHARGER_ACTION})
 	if err != nil {
@@ -99,19 +229,59 @@ func main() {
 		log.Fatalln(err)
 	}
 
+	chargerStatusChannel, err := device.SubscribeToChargerStatus(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var currentSetPoint float64
+	var chargerStatus *common.ChargerStatus
+
+	// the device is called outside of the main loop, applying a set point can
+	// take up to Ocpp.CallTimeout. Only the latest set point is applied.
+	deviceSetPointChannel := make(chan float64, 1)
+	go func() {
+		for {
+			select {
+			case setPoint := <-deviceSetPointChannel:
+				if err := device.PublishChargingSetPoint(ctx, setPoint); errors.Is(err, mqtt.ErrQueued) {
+					log.Printf("charger - charging set point queued until the broker is reachable")
+				} else if err != nil {
+					log.Printf("charger - could not send charging set point to the device: %s", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	chargingSetPointMonitorDuration := cfg.Controller.Periode + cfg.Charger.MaximumAcceptableSetPointOffset
 	var chargingSetPointMonitor common.Timer
 	chargingSetPointMonitor.Start(chargingSetPointMonitorDuration, func() {
-		log.Println("charger - charging set point timeout")
+		leaderInfo := ddaConnector.LeaderInfo()
+		log.Printf("charger - charging set point timeout, last heartbeat of leader %s (term %d) at %s", leaderInfo.LeaderId, leaderInfo.Term, leaderInfo.LastHeartbeat)
 	})
 
+	leaderInfoChannel := ddaConnector.LeaderInfoCh(ctx)
+	var currentLeader dda.LeaderInfo
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	for {
 		select {
+		case leaderInfo := <-leaderInfoChannel:
+			if leaderInfo.LeaderId != currentLeader.LeaderId || leaderInfo.Term != currentLeader.Term {
+				log.Printf("charger - controlled by leader %s (term %d)", leaderInfo.LeaderId, leaderInfo.Term)
+			}
+			currentLeader = leaderInfo
+		case status := <-chargerStatusChannel:
+			if len(status.ErrorCodes) > 0 && (chargerStatus == nil || len(chargerStatus.ErrorCodes) == 0) {
+				log.Printf("charger - device reports errors %v", status.ErrorCodes)
+			}
+			chargerStatus = &status
 		case getChargerRequest := <-getChargerChannel:
-			msg := common.Message{Id: cfg.Id, Timestamp: time.Now()}
+			msg := common.ChargerMessage{Message: common.Message{Id: cfg.Id, Timestamp: time.Now()}, SetPoint: currentSetPoint, Status: chargerStatus}
 			data, _ := json.Marshal(msg)
 			getChargerRequest.Callback(api.ActionResult{Data: data})
 		case chargingSetPoint := <-chargingSetPointChannel:
@@ -128,7 +298,12 @@ func main() {
 			if value.Timestamp.After(time.Now().Add(-cfg.Charger.MaximumAcceptableSetPointOffset)) {
 				log.Printf("charger - got new charging set point: %f", value.Value)
 				chargingSetPointMonitor.Reset(chargingSetPointMonitorDuration)
-				mqttConnector.PublishChargingSetPoint(ctx, value.Value)
+				currentSetPoint = value.Value
+				select {
+				case <-deviceSetPointChannel:
+				default:
+				}
+				deviceSetPointChannel <- value.Value
 			} else {
 				log.Println("charger - got too old charging set point, ignoring it")
 				log.Printf("charger - now: %s, got: %s", time.Now(), value.Timestamp)
@@ -138,61 +313,3 @@ func main() {
 		}
 	}
 }
-
-func register(ctx context.Context, ddaConnector *dda.Connector, cfg *common.Config) {
-	registerContext, registerCancel := context.WithCancel(ctx)
-	defer registerCancel()
-	registerResponseChannel, err := ddaConnector.SubscribeEvent(registerContext, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	for {
-		log.Println("charger - trying to register node")
-
-		err = ddaConnector.RegisterNode(cfg.Id, cfg.SensorId)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		select {
-		case receivedId := <-registerResponseChannel:
-			if string(receivedId.Data) == cfg.Id {
-				log.Println("charger - node registered")
-				return
-			}
-		case <-time.After(5 * time.Second):
-			continue
-		case <-registerContext.Done():
-			return
-		}
-	}
-}
-
-func deregister(ctx context.Context, ddaConnector *dda.Connector, cfg *common.Config) {
-	deregisterContext, deregisterCancel := context.WithCancel(ctx)
-	defer deregisterCancel()
-
-	deregisterResponseChannel, err := ddaConnector.SubscribeEvent(deregisterContext, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
-	if err != nil {
-		log.Fatalln(err)
-	}
-	for {
-		log.Println("charger - trying to deregister node")
-
-		err = ddaConnector.DeregisterNode(cfg.Id, cfg.SensorId)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		select {
-		case receivedId := <-deregisterResponseChannel:
-			if string(receivedId.Data) == cfg.Id {
-				log.Println("charger - node deregistered")
-				return
-			}
-		case <-time.After(5 * time.Second):
-			continue
-		}
-	}
-}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"code.siemens.com/energy-community-controller/dda"
+	"github.com/google/uuid"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] list | add-voter <node id> | add-nonvoter <node id> | remove <node id>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var url string
+	var energyCommunityId string
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout for the raft leader to answer")
+	membershipSecretFile := flag.String("membershipSecretFile", "", "file containing the membership secret of the raft leader (env MEMBERSHIP_SECRET_FILE or MEMBERSHIP_SECRET)")
+	flag.StringVar(&url, "url", "tcp://localhost:1883", "mqtt url")
+	flag.StringVar(&energyCommunityId, "energyCommunityId", "energyCommunity", "energy community id")
+	flag.Usage = usage
+	flag.Parse()
+
+	op := flag.Arg(0)
+	nodeId := flag.Arg(1)
+	if op == "" || (op != dda.MembershipList && nodeId == "") {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg := common.NewConfig()
+	cfg.Auth.MembershipSecretFile = *membershipSecretFile
+	cfg.Name = "membership"
+	cfg.Url = url
+	cfg.Id = uuid.NewString()
+	cfg.EnergyCommunityId = energyCommunityId
+
+	if err := cfg.Auth.Resolve(); err != nil {
+		log.Fatalln(err)
+	}
+
+	ddaConnector, err := dda.NewConnector(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err = ddaConnector.Open(); err != nil {
+		log.Fatalln(err)
+	}
+	defer ddaConnector.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch op {
+	case dda.MembershipList:
+		var members []dda.Member
+		if members, err = ddaConnector.Members(ctx); err == nil {
+			for _, member := range members {
+				role := "non-voter"
+				if member.Leader {
+					role = "leader"
+				} else if member.Voter {
+					role = "voter"
+				}
+				fmt.Printf("%s\t%s\n", member.Id, role)
+			}
+		}
+	case dda.MembershipAddVoter:
+		err = ddaConnector.AddVoter(ctx, nodeId)
+	case dda.MembershipAddNonvoter:
+		err = ddaConnector.AddNonvoter(ctx, nodeId)
+	case dda.MembershipRemove:
+		err = ddaConnector.RemoveMember(ctx, nodeId)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Printf("membership - %s failed: %s", op, err)
+		ddaConnector.Close()
+		os.Exit(1)
+	}
+}
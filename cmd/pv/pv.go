@@ -3,46 +3,87 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"code.siemens.com/energy-community-controller/common"
 	"code.siemens.com/energy-community-controller/controller"
 	"code.siemens.com/energy-community-controller/dda"
 	"code.siemens.com/energy-community-controller/mqtt"
+	"code.siemens.com/energy-community-controller/registration"
+	"code.siemens.com/energy-community-controller/sunspec"
 	"github.com/coatyio/dda/services/com/api"
 	"github.com/google/uuid"
 )
 
+// pvDevice is the inverter, reached by MQTT or Modbus TCP.
+type pvDevice interface {
+	SubscribeToPvProduction(ctx context.Context) (<-chan float64, error)
+}
+
 func main() {
 	log.Println("starting pv")
 
+	cfg := common.NewConfig()
+
 	var id string
 	var url string
 	var energyCommunityId string
 	var sensorId string
 	bootstrap := flag.Bool("b", false, "bootstrap raft")
 	leadershipElectionEnabled := flag.Bool("l", false, "participate in leader election")
+	leadershipObserved := flag.Bool("o", false, "observe the leader election without participating")
+	dataDir := flag.String("data", "", "directory for the raft log and snapshots, the replicated state is not persisted if empty")
+	leaderPriority := flag.Int("priority", 0, "leader election priority, nodes with a higher priority are preferred as leader")
 	flag.StringVar(&id, "id", uuid.NewString(), "node id")
 	flag.StringVar(&url, "url", "tcp://localhost:1883", "mqtt url")
 	flag.StringVar(&energyCommunityId, "energyCommunityId", "energyCommunity", "energy community id")
 	flag.StringVar(&sensorId, "sensorId", "sensor", "sensor id")
+	mqttMapping := flag.String("mqttMapping", "", "JSON file with MQTT topic templates and payload mappings")
+	flag.StringVar(&cfg.Auth.CaFile, "ca", "", "CA certificate file to verify the MQTT broker (env MQTT_CA_FILE)")
+	flag.StringVar(&cfg.Auth.CertFile, "cert", "", "client certificate file (env MQTT_CERT_FILE)")
+	flag.StringVar(&cfg.Auth.KeyFile, "key", "", "client key file (env MQTT_KEY_FILE)")
+	flag.StringVar(&cfg.Auth.Username, "username", "", "MQTT username (env MQTT_USERNAME)")
+	flag.StringVar(&cfg.Auth.PasswordFile, "passwordFile", "", "file containing the MQTT password (env MQTT_PASSWORD_FILE or MQTT_PASSWORD)")
+	flag.StringVar(&cfg.Auth.MembershipSecretFile, "membershipSecretFile", "", "file containing the secret of raft membership requests (env MEMBERSHIP_SECRET_FILE or MEMBERSHIP_SECRET)")
+	flag.BoolVar(&cfg.Mqtt.Discovery.Enabled, "homeassistant", false, "publish Home Assistant MQTT discovery configs")
+	flag.StringVar(&cfg.SunSpec.Address, "sunspec", "", "host:port of a SunSpec inverter polled over Modbus TCP, the MQTT production topic is used if empty")
+	flag.DurationVar(&cfg.Mqtt.SessionExpiryInterval, "sessionExpiry", 0, "keep the MQTT session on the broker for this time after a disconnect, e.g. 1h, a clean session is started if 0")
+	tags := flag.String("tags", "", "comma separated key=value tags sent on registration")
 	flag.Parse()
 
-	cfg := common.NewConfig()
 	cfg.Name = "pv"
 	cfg.Url = url
 	cfg.Id = id
 	cfg.EnergyCommunityId = energyCommunityId
+	cfg.Tags = common.ParseTags(*tags)
 	cfg.Leader.Enabled = *leadershipElectionEnabled
+	cfg.Leader.Observe = *leadershipObserved
 	cfg.Leader.Bootstrap = *bootstrap
+	cfg.Leader.Priority = *leaderPriority
+	cfg.Leader.DataDir = *dataDir
+
+	if err := cfg.Auth.Resolve(); err != nil {
+		log.Fatalln(err)
+	}
+
+	if *mqttMapping != "" {
+		if err := mqtt.LoadMapping(*mqttMapping, &cfg.Mqtt); err != nil {
+			log.Fatalln(err)
+		}
+	}
 
 	var ddaConnector *dda.Connector
+	var ctrl *controller.Controller
+	var registrationClient *registration.Client
 	var mqttConnector *mqtt.Connector
 	var pvProduction float64
+	var measuredAt time.Time
 	var err error
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -50,7 +91,26 @@ func main() {
 	defer func() {
 		log.Println("shutting down")
 
-		deregister(ctx, ddaConnector, cfg)
+		// the leadership is handed over when the DDA connector is closed,
+		// the current allocation round is finished before
+		if ctrl != nil {
+			stopCtx, stopCancel := context.WithTimeout(ctx, cfg.Controller.Periode)
+			if err := ctrl.Stop(stopCtx); err != nil {
+				log.Printf("pv - could not finish the allocation round: %s", err)
+			}
+			stopCancel()
+		}
+
+		if registrationClient != nil {
+			deregisterCtx, deregisterCancel := context.WithTimeout(ctx, cfg.Registration.ShutdownTimeout)
+			if err := registrationClient.Deregister(deregisterCtx); err != nil {
+				log.Printf("pv - could not deregister node: %s", err)
+			} else if mqttConnector != nil {
+				mqttConnector.SetRegistered(deregisterCtx, false)
+			}
+			deregisterCancel()
+		}
+
 		cancel()
 
 		if ddaConnector != nil {
@@ -71,12 +131,11 @@ func main() {
 	}
 
 	if cfg.Leader.Enabled {
-		if controller, err := controller.NewController(cfg.Controller, ddaConnector); err != nil {
+		if ctrl, err = controller.NewController(cfg.Controller, ddaConnector); err != nil {
+			log.Fatalln(err)
+		}
+		if err := ctrl.Start(ctx); err != nil {
 			log.Fatalln(err)
-		} else {
-			if err := controller.Start(ctx); err != nil {
-				log.Fatalln(err)
-			}
 		}
 	}
 
@@ -88,90 +147,161 @@ func main() {
 		log.Fatalln(err)
 	}
 
-	register(ctx, ddaConnector, cfg)
+	capabilities := []string{common.CAPABILITY_PRODUCTION, common.CAPABILITY_PRODUCTION_LIMIT}
+	if cfg.Mqtt.Discovery.Enabled {
+		if err := mqttConnector.PublishDiscovery(ctx, capabilities); err != nil {
+			log.Printf("pv - could not publish Home Assistant discovery: %s", err)
+		}
+	}
+
+	if ctrl != nil {
+		go func() {
+			for {
+				select {
+				case strategy := <-mqttConnector.AllocationStrategyCh():
+					if err := ctrl.SetAllocationStrategy(strategy); err != nil {
+						log.Printf("pv - could not change allocation strategy: %s", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	registrationClient = registration.NewClient(cfg.Registration, ddaConnector, common.DdaRegisterMessage{
+		NodeId:       cfg.Id,
+		SensorId:     cfg.SensorId,
+		NodeType:     common.NODE_TYPE_PV,
+		Version:      common.Version,
+		Capabilities: capabilities,
+		Tags:         cfg.Tags,
+		LeaseTimeout: cfg.Lease.Timeout.Milliseconds(),
+	})
+	if err := registrationClient.Register(ctx); err != nil {
+		log.Fatalln(err)
+	}
+	if err := mqttConnector.SetRegistered(ctx, true); err != nil {
+		log.Printf("pv - could not publish status: %s", err)
+	}
+
+	go func() {
+		for isLeader := range ddaConnector.LeaderCh(ctx) {
+			if err := mqttConnector.SetLeader(ctx, isLeader); err != nil {
+				log.Printf("pv - could not publish status: %s", err)
+			}
+		}
+	}()
+
+	// the renewals are stopped before the node deregisters
+	leaseCtx, leaseCancel := context.WithCancel(ctx)
+	leaseDone := make(chan struct{})
+	go func() {
+		registrationClient.RenewLeases(leaseCtx, cfg.Lease)
+		close(leaseDone)
+	}()
+	defer func() {
+		leaseCancel()
+		<-leaseDone
+	}()
 
 	getProductionChannel, err := ddaConnector.SubscribeAction(ctx, api.SubscriptionFilter{Type: common.PRODUCTION_ACTION})
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	productionChannel, err := mqttConnector.SubscribeToPvProduction(ctx)
+	var device pvDevice = mqttConnector
+	if cfg.SunSpec.Address != "" {
+		device = sunspec.NewReader(cfg.SunSpec)
+	}
+
+	productionChannel, err := device.SubscribeToPvProduction(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	productionLimitChannel, err := ddaConnector.SubscribeEvent(ctx, api.SubscriptionFilter{Type: common.PRODUCTION_LIMIT})
 	if err != nil {
 		log.Fatalln(err)
 	}
 
+	// currentLimit is the limit delivered to the broker, a queued limit is
+	// not delivered yet and published again with the next limit
+	var currentLimit common.ProductionLimit
+	limitDelivered := true
+	// the curtailment is lifted if the limit is not renewed in time, e.g. if
+	// the leader is lost
+	limitExpiry := time.NewTimer(0)
+	<-limitExpiry.C
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	for {
 		select {
 		case newProduction := <-productionChannel:
 			log.Printf("Got new production value: %f", newProduction)
 			pvProduction = newProduction
+			measuredAt = time.Now()
 		case getProductionRequest := <-getProductionChannel:
-			msg := common.Value{Message: common.Message{Id: cfg.Id, Timestamp: time.Now()}, Value: pvProduction}
+			msg := common.Value{Message: common.Message{Id: cfg.Id, Timestamp: time.Now()}, Value: pvProduction, MeasuredAt: measuredAt, Quality: common.QUALITY_GOOD}
+			if measuredAt.IsZero() {
+				msg.Quality = common.QUALITY_MISSING
+			} else if time.Since(measuredAt) > cfg.Pv.StaleTimeout {
+				msg.Quality = common.QUALITY_STALE
+			}
 			data, _ := json.Marshal(msg)
 			getProductionRequest.Callback(api.ActionResult{Data: data})
-		case <-sigChan:
-			return
-		}
-	}
-}
+		case productionLimit := <-productionLimitChannel:
+			var limit common.ProductionLimit
+			if err := json.Unmarshal(productionLimit.Data, &limit); err != nil {
+				log.Printf("Could not unmarshal incoming production limit, %s", err)
+				continue
+			}
 
-func register(ctx context.Context, ddaConnector *dda.Connector, cfg *common.Config) {
-	registerContext, registerCancel := context.WithCancel(ctx)
-	defer registerCancel()
-	registerResponseChannel, err := ddaConnector.SubscribeEvent(registerContext, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
-	if err != nil {
-		log.Fatalln(err)
-	}
+			if limit.Id != cfg.Id {
+				continue
+			}
 
-	for {
-		log.Println("pv - trying to register node")
+			if limit.Timestamp.Before(time.Now().Add(-cfg.Pv.MaximumAcceptableLimitOffset)) {
+				log.Println("pv - got too old production limit, ignoring it")
+				continue
+			}
 
-		err = ddaConnector.RegisterNode(cfg.Id, cfg.SensorId)
-		if err != nil {
-			log.Fatalln(err)
-		}
+			if limit.Curtailed && !limit.ValidUntil.IsZero() {
+				limitExpiry.Reset(time.Until(limit.ValidUntil))
+			} else {
+				limitExpiry.Stop()
+			}
 
-		select {
-		case receivedId := <-registerResponseChannel:
-			if string(receivedId.Data) == cfg.Id {
-				log.Println("pv - node registered")
-				return
+			if limitDelivered && limit.Curtailed == currentLimit.Curtailed && limit.Limit == currentLimit.Limit {
+				continue
+			}
+
+			if limit.Curtailed {
+				log.Printf("pv - curtailing production to %f", limit.Limit)
+			} else {
+				log.Println("pv - curtailment lifted")
 			}
-		case <-time.After(5 * time.Second):
-			continue
-		case <-registerContext.Done():
+			currentLimit = limit
+			limitDelivered = publishProductionLimit(ctx, mqttConnector, limit.Limit, limit.Curtailed)
+		case <-limitExpiry.C:
+			log.Println("pv - production limit expired, curtailment lifted")
+			currentLimit = common.ProductionLimit{}
+			limitDelivered = publishProductionLimit(ctx, mqttConnector, 0, false)
+		case <-sigChan:
 			return
 		}
 	}
 }
 
-func deregister(ctx context.Context, ddaConnector *dda.Connector, cfg *common.Config) {
-	deregisterContext, deregisterCancel := context.WithCancel(ctx)
-	defer deregisterCancel()
-
-	deregisterResponseChannel, err := ddaConnector.SubscribeEvent(deregisterContext, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
-	if err != nil {
-		log.Fatalln(err)
-	}
-	for {
-		log.Println("pv - trying to deregister node")
-
-		err = ddaConnector.DeregisterNode(cfg.Id, cfg.SensorId)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		select {
-		case receivedId := <-deregisterResponseChannel:
-			if string(receivedId.Data) == cfg.Id {
-				log.Println("pv - node deregistered")
-				return
-			}
-		case <-time.After(5 * time.Second):
-			continue
-		}
+// publishProductionLimit reports whether the limit was delivered to the broker.
+func publishProductionLimit(ctx context.Context, mqttConnector *mqtt.Connector, limit float64, curtailed bool) bool {
+	err := mqttConnector.PublishProductionLimit(ctx, limit, curtailed)
+	if errors.Is(err, mqtt.ErrQueued) {
+		log.Println("pv - production limit queued until the broker is reachable")
+	} else if err != nil {
+		log.Printf("pv - could not publish production limit: %s", err)
 	}
+	return err == nil
 }
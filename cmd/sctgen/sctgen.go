@@ -0,0 +1,275 @@
+// sctgen generates a typed Go package from one or more supervisor definitions.
+//
+// The generated package contains a constant per event, the transition tables
+// of all supervisors and a Callbacks interface with one method per
+// controllable event. It is meant to be used with go generate:
+//
+//	//go:generate go run ../cmd/sctgen -p supervisor -o supervisor/supervisor.go ../resources/simpleController1.xml ../resources/simpleController2.xml
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"code.siemens.com/energy-community-controller/sct"
+)
+
+type generatorEvent struct {
+	Name         string
+	Identifier   string
+	Controllable bool
+}
+
+type generatorModel struct {
+	Source string
+	Model  sct.Model
+}
+
+type options struct {
+	minimize bool
+	plant    *sct.Model
+}
+
+type generatorData struct {
+	Package string
+	Sources []string
+	Events  []generatorEvent
+	Models  []generatorModel
+}
+
+func main() {
+	var packageName string
+	var output string
+	var plant string
+	var opts options
+	flag.StringVar(&packageName, "p", "supervisor", "name of the generated package")
+	flag.StringVar(&output, "o", "", "output file (default stdout)")
+	flag.StringVar(&plant, "plant", "", "reduce the supervisors with respect to this plant")
+	flag.BoolVar(&opts.minimize, "minimize", false, "minimize the supervisors")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatalln("sctgen - no supervisor definitions given")
+	}
+
+	if plant != "" {
+		models, err := loadFile(plant)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(models) != 1 {
+			log.Fatalf("sctgen - plant %s has to contain exactly one automaton, got %d", plant, len(models))
+		}
+		opts.plant = &models[0]
+	}
+
+	data, err := load(packageName, flag.Args(), opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	models := make([]sct.Model, 0, len(data.Models))
+	for _, m := range data.Models {
+		models = append(models, m.Model)
+	}
+	if report := sct.CheckNonblocking(models); !report.Nonblocking {
+		log.Printf("sctgen - WARNING supervisors are %s", report)
+	}
+
+	code, err := generate(data)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if output == "" {
+		os.Stdout.Write(code)
+		return
+	}
+
+	if err := os.WriteFile(output, code, 0644); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func load(packageName string, files []string, opts options) (*generatorData, error) {
+	data := generatorData{Package: packageName}
+	knownEvents := make(map[string]generatorEvent)
+	knownIdentifiers := make(map[string]string)
+
+	for _, file := range files {
+		models, err := loadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		source := filepath.Base(file)
+		data.Sources = append(data.Sources, source)
+
+		for _, model := range models {
+			if opts.plant != nil {
+				var report sct.ReductionReport
+				if model, report, err = sct.Reduce(model, *opts.plant); err != nil {
+					return nil, fmt.Errorf("%s: %v", file, err)
+				}
+				log.Printf("sctgen - reduced supervisor %s", report)
+			}
+
+			if opts.minimize {
+				var report sct.ReductionReport
+				model, report = sct.Minimize(model)
+				log.Printf("sctgen - minimized supervisor %s", report)
+			}
+
+			if err := data.addModel(source, model, knownEvents, knownIdentifiers); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+		}
+	}
+
+	return &data, nil
+}
+
+func loadFile(file string) ([]sct.Model, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	models, err := sct.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return models, nil
+}
+
+func (data *generatorData) addModel(source string, model sct.Model, knownEvents map[string]generatorEvent, knownIdentifiers map[string]string) error {
+	if model.ID != "" && model.ID != "Untitled" {
+		source = fmt.Sprintf("%s (%s)", source, model.ID)
+	}
+	data.Models = append(data.Models, generatorModel{Source: source, Model: model})
+
+	for _, e := range model.Data.Events {
+		event := generatorEvent{Name: e.Name, Identifier: toIdentifier(e.Name), Controllable: e.Controllable == "True"}
+
+		if known, ok := knownEvents[e.Name]; ok {
+			if known.Controllable != event.Controllable {
+				return fmt.Errorf("event %s is controllable in one supervisor and uncontrollable in another", e.Name)
+			}
+			continue
+		}
+
+		if other, ok := knownIdentifiers[event.Identifier]; ok {
+			return fmt.Errorf("events %s and %s map to the same identifier %s", other, e.Name, event.Identifier)
+		}
+
+		knownEvents[e.Name] = event
+		knownIdentifiers[event.Identifier] = e.Name
+		data.Events = append(data.Events, event)
+	}
+
+	return nil
+}
+
+func generate(data *generatorData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := codeTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %v", err)
+	}
+
+	return code, nil
+}
+
+// toIdentifier converts an event name like "calculateEqualAllocationSetPoints"
+// or "data-received" into an exported Go identifier.
+func toIdentifier(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var sb strings.Builder
+	for _, part := range parts {
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+
+	identifier := sb.String()
+	if identifier == "" || unicode.IsDigit([]rune(identifier)[0]) {
+		identifier = "E" + identifier
+	}
+
+	return identifier
+}
+
+var codeTemplate = template.Must(template.New("supervisor").Parse(`// Code generated by sctgen from {{range $i, $s := .Sources}}{{if $i}}, {{end}}{{$s}}{{end}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import "code.siemens.com/energy-community-controller/sct"
+
+const (
+{{- range .Events}}
+	Event{{.Identifier}} = {{printf "%q" .Name}}
+{{- end}}
+)
+
+// Callbacks has to be implemented by the user of the supervisors, it has one
+// method per controllable event.
+type Callbacks interface {
+{{- range .Events}}{{if .Controllable}}
+	{{.Identifier}}()
+{{- end}}{{end}}
+}
+
+// CallbackMap maps the controllable events to the methods of the given
+// callbacks, as expected by sct.NewSCTFromModels.
+func CallbackMap(callbacks Callbacks) map[string]func() {
+	return map[string]func(){
+{{- range .Events}}{{if .Controllable}}
+		Event{{.Identifier}}: callbacks.{{.Identifier}},
+{{- end}}{{end}}
+	}
+}
+
+// Models contains the transition tables of all supervisors.
+var Models = []sct.Model{
+{{- range .Models}}
+	// {{.Source}}
+	{
+		ID: {{printf "%q" .Model.ID}},
+		Data: sct.Data{
+			States: []sct.State{
+{{- range .Model.Data.States}}
+				{ID: {{printf "%q" .ID}}, Name: {{printf "%q" .Name}}, Initial: {{printf "%q" .Initial}}, Marked: {{printf "%q" .Marked}}},
+{{- end}}
+			},
+			Events: []sct.Event{
+{{- range .Model.Data.Events}}
+				{ID: {{printf "%q" .ID}}, Name: {{printf "%q" .Name}}, Controllable: {{printf "%q" .Controllable}}, Observable: {{printf "%q" .Observable}}},
+{{- end}}
+			},
+			Transitions: []sct.Transition{
+{{- range .Model.Data.Transitions}}
+				{Source: {{printf "%q" .Source}}, Target: {{printf "%q" .Target}}, Event: {{printf "%q" .Event}}},
+{{- end}}
+			},
+		},
+	},
+{{- end}}
+}
+`))
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGolden generates the supervisor package like the go:generate directive
+// in controller/logic.go and compares it with the checked in package.
+func TestGolden(t *testing.T) {
+	data, err := load("supervisor", []string{"../../resources/simpleController1.xml", "../../resources/simpleController2.xml"}, options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := generate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden, err := os.ReadFile("../../controller/supervisor/supervisor.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(code, golden) {
+		t.Errorf("Generated code differs from controller/supervisor/supervisor.go, run go generate ./controller")
+	}
+}
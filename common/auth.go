@@ -0,0 +1,97 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AuthConfig configures TLS and authentication of the connections to the MQTT
+// broker, used for the devices as well as for the DDA communication.
+type AuthConfig struct {
+	CaFile             string
+	CertFile           string
+	KeyFile            string
+	Username           string
+	Password           string
+	PasswordFile       string
+	InsecureSkipVerify bool
+	// MembershipSecret authenticates raft membership requests forwarded to
+	// the raft leader, the leader rejects them all if it has no secret
+	MembershipSecret     string
+	MembershipSecretFile string
+}
+
+// Resolve fills all values which are not set from the environment variables
+// MQTT_CA_FILE, MQTT_CERT_FILE, MQTT_KEY_FILE, MQTT_USERNAME, MQTT_PASSWORD,
+// MQTT_PASSWORD_FILE, MEMBERSHIP_SECRET and MEMBERSHIP_SECRET_FILE and reads
+// the password and secret files.
+func (a *AuthConfig) Resolve() error {
+	fromEnv := func(value *string, name string) {
+		if *value == "" {
+			*value = os.Getenv(name)
+		}
+	}
+
+	fromEnv(&a.CaFile, "MQTT_CA_FILE")
+	fromEnv(&a.CertFile, "MQTT_CERT_FILE")
+	fromEnv(&a.KeyFile, "MQTT_KEY_FILE")
+	fromEnv(&a.Username, "MQTT_USERNAME")
+	fromEnv(&a.Password, "MQTT_PASSWORD")
+	fromEnv(&a.PasswordFile, "MQTT_PASSWORD_FILE")
+	fromEnv(&a.MembershipSecret, "MEMBERSHIP_SECRET")
+	fromEnv(&a.MembershipSecretFile, "MEMBERSHIP_SECRET_FILE")
+
+	if a.Password == "" && a.PasswordFile != "" {
+		password, err := os.ReadFile(a.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("could not read password file: %w", err)
+		}
+		a.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
+	if a.MembershipSecret == "" && a.MembershipSecretFile != "" {
+		secret, err := os.ReadFile(a.MembershipSecretFile)
+		if err != nil {
+			return fmt.Errorf("could not read membership secret file: %w", err)
+		}
+		a.MembershipSecret = strings.TrimRight(string(secret), "\r\n")
+	}
+
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		return fmt.Errorf("client certificate and key have to be given both")
+	}
+
+	return nil
+}
+
+// TLSConfig creates the TLS configuration with the CA and the client
+// certificate. Without CA the system roots are used.
+func (a *AuthConfig) TLSConfig() (*tls.Config, error) {
+	//#nosec G402 -- InsecureSkipVerify is false by default
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: a.InsecureSkipVerify}
+
+	if a.CaFile != "" {
+		pem, err := os.ReadFile(a.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", a.CaFile)
+		}
+	}
+
+	if a.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
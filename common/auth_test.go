@@ -0,0 +1,78 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuthResolve(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MQTT_USERNAME", "env-user")
+	t.Setenv("MQTT_PASSWORD_FILE", passwordFile)
+
+	auth := AuthConfig{Username: "flag-user"}
+	if err := auth.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+
+	if auth.Username != "flag-user" || auth.Password != "secret" {
+		t.Errorf("Wrong credentials: %+v", auth)
+	}
+
+	auth = AuthConfig{CertFile: "client.pem"}
+	if err := auth.Resolve(); err == nil {
+		t.Errorf("Missing key not detected")
+	}
+}
+
+func TestAuthTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test"}, NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+
+	auth := AuthConfig{CaFile: certFile, CertFile: certFile, KeyFile: keyFile}
+	config, err := auth.TLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.RootCAs == nil || len(config.Certificates) != 1 || config.InsecureSkipVerify {
+		t.Errorf("Wrong TLS config: %+v", config)
+	}
+
+	auth = AuthConfig{CaFile: keyFile}
+	if _, err := auth.TLSConfig(); err == nil {
+		t.Errorf("CA file without certificates not detected")
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,21 +13,159 @@ type Config struct {
 	Id                string
 	SensorId          string
 	EnergyCommunityId string
-	Leader            LeaderConfig
-	Controller        ControllerConfig
-	Charger           ChargerConfig
+	Auth              AuthConfig
+	// Tags are sent on registration, e.g. the location of a node
+	Tags         map[string]string
+	Leader       LeaderConfig
+	Lease        LeaseConfig
+	Registration RegistrationConfig
+	Mqtt         MqttConfig
+	Controller   ControllerConfig
+	Charger      ChargerConfig
+	Ocpp         OcppConfig
+	SunSpec      SunSpecConfig
+	Pv           PvConfig
 }
 
 type LeaderConfig struct {
-	Enabled              bool
+	Enabled bool
+	// Observe lets a node which is not part of the leader election follow the
+	// elected leader through the replicated state
+	Observe              bool
 	Bootstrap            bool
+	Priority             int
 	HeartbeatPeriode     time.Duration
 	HeartbeatTimeoutBase time.Duration
+	// DataDir stores the raft log and snapshots, the replicated state is kept
+	// in memory only if empty
+	DataDir           string
+	SnapshotInterval  time.Duration
+	SnapshotThreshold int
+}
+
+// LeaseConfig configures how often a node renews its liveness lease and after
+// which time without renewal the leader considers it lost.
+type LeaseConfig struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// RegistrationConfig configures the retries of registration requests and how
+// long a node waits for its deregistration on shutdown.
+type RegistrationConfig struct {
+	RetryBase       time.Duration
+	RetryMax        time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// MqttConfig maps the values exchanged with the devices to MQTT topics and
+// payloads.
+type MqttConfig struct {
+	Production       PayloadMapping
+	ChargingSetPoint PayloadMapping
+	ProductionLimit  PayloadMapping
+	ChargerStatus    ChargerStatusMapping
+	// StatusTopic is a topic template like PayloadMapping.Topic, the retained
+	// online status of the node is published on it
+	StatusTopic string
+	Discovery   DiscoveryConfig
+	// QueueSize is the number of topics whose latest set point or limit is
+	// kept while the broker is not reachable, queueing is disabled if 0
+	QueueSize int
+	// SessionExpiryInterval keeps the session on the broker for the given
+	// time after a disconnect, a clean session is started if 0
+	SessionExpiryInterval time.Duration
+}
+
+// ChargerStatusMapping describes the status telemetry of a charger. The
+// topics of the value mappings are ignored, all values are taken from the
+// payload on Topic.
+type ChargerStatusMapping struct {
+	Topic         string
+	ChargingPower PayloadMapping
+	SessionEnergy PayloadMapping
+	// Plugged is the JSON path of the plug state, a boolean, 0/1 or
+	// "true"/"false"
+	Plugged string
+	// ErrorCodes is the JSON path of an error code or a list of error codes,
+	// no errors are assumed if it is missing in the payload
+	ErrorCodes string
+}
+
+// DiscoveryConfig configures the Home Assistant MQTT discovery.
+type DiscoveryConfig struct {
+	Enabled bool
+	Prefix  string
+	// AllocationStrategyTopic is a topic template for the state of the
+	// allocation strategy select of leader candidates, commands are received
+	// on <topic>/set
+	AllocationStrategyTopic string
+}
+
+// PayloadMapping describes the topic and the position and unit of a value in
+// the payload of a device.
+type PayloadMapping struct {
+	// Topic is a template, {{.Id}}, {{.SensorId}}, {{.Name}} and
+	// {{.EnergyCommunityId}} are replaced by the node configuration
+	Topic string
+	// Path is the dot separated JSON path of the value, e.g. "data.ac.0.power".
+	// The whole payload is the value if empty.
+	Path string
+	// Scale and Unit (W, kW or MW, Wh, kWh or MWh for energies) convert the
+	// device value to W or Wh
+	Scale float64
+	Unit  string
+	// AsString sends the value as JSON string instead of a number
+	AsString bool
 }
 
 type ControllerConfig struct {
 	Periode           time.Duration
 	WaitTimeForInputs time.Duration
+	// registrations of other node types or older versions are rejected, no
+	// minimum version is required if empty
+	AcceptedNodeTypes  []string
+	MinimumNodeVersion string
+	AllocationStrategy string
+	// GridExportLimit is the power in W the community may feed into the grid,
+	// the PV production is curtailed if the chargers cannot absorb the
+	// surplus. It is not limited if negative.
+	GridExportLimit float64
+	// CurtailmentHysteresis is the power in W the surplus has to drop below
+	// GridExportLimit before the curtailment is lifted
+	CurtailmentHysteresis float64
+	// ChargerMaximumPower caps the set point of a charger in W, it is not
+	// capped if 0
+	ChargerMaximumPower float64
+	// IgnoreUnregisteredNodes leaves the production and chargers of nodes
+	// which are not registered out of the allocation
+	IgnoreUnregisteredNodes bool
+}
+
+// OcppConfig configures the OCPP 1.6J central system a charger node offers to
+// its charge point.
+type OcppConfig struct {
+	// ListenAddress of the WebSocket server, OCPP is disabled if empty
+	ListenAddress     string
+	ConnectorId       int
+	HeartbeatInterval time.Duration
+	CallTimeout       time.Duration
+}
+
+// SunSpecConfig configures the Modbus TCP connection of a PV node to a SunSpec
+// inverter.
+type SunSpecConfig struct {
+	// Address is host:port of the inverter, SunSpec is disabled if empty
+	Address      string
+	UnitId       byte
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+type PvConfig struct {
+	MaximumAcceptableLimitOffset time.Duration
+	// StaleTimeout is the age after which a production measurement is stale
+	StaleTimeout time.Duration
 }
 
 type ChargerConfig struct {
@@ -40,18 +179,104 @@ func NewConfig() *Config {
 		Id:                uuid.NewString(),
 		SensorId:          "",
 		EnergyCommunityId: "energyCommunity",
+		Tags:              make(map[string]string),
 		Leader: LeaderConfig{
 			Enabled:              false,
+			Observe:              false,
 			Bootstrap:            false,
+			Priority:             0,
 			HeartbeatPeriode:     1000 * time.Millisecond,
 			HeartbeatTimeoutBase: 1200 * time.Millisecond,
+			DataDir:              "",
+			SnapshotInterval:     120 * time.Second,
+			SnapshotThreshold:    1024,
+		},
+		Lease: LeaseConfig{
+			Interval: 5 * time.Second,
+			Timeout:  15 * time.Second,
+		},
+		Registration: RegistrationConfig{
+			RetryBase:       500 * time.Millisecond,
+			RetryMax:        5 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Mqtt: MqttConfig{
+			Production: PayloadMapping{
+				Topic: "{{.Id}}/production",
+				Path:  "production",
+				Scale: 1,
+				Unit:  "W",
+			},
+			ChargingSetPoint: PayloadMapping{
+				Topic: "{{.Id}}/chargingSetPoint",
+				Path:  "chargingSetPoint",
+				Scale: 1,
+				Unit:  "W",
+			},
+			ProductionLimit: PayloadMapping{
+				Topic: "{{.Id}}/productionLimit",
+				Path:  "productionLimit",
+				Scale: 1,
+				Unit:  "W",
+			},
+			ChargerStatus: ChargerStatusMapping{
+				Topic:         "{{.Id}}/chargerStatus",
+				ChargingPower: PayloadMapping{Path: "chargingPower", Scale: 1, Unit: "W"},
+				SessionEnergy: PayloadMapping{Path: "sessionEnergy", Scale: 1, Unit: "Wh"},
+				Plugged:       "plugged",
+				ErrorCodes:    "errorCodes",
+			},
+			StatusTopic:           "{{.Id}}/status",
+			QueueSize:             100,
+			SessionExpiryInterval: 0,
+			Discovery: DiscoveryConfig{
+				Enabled:                 false,
+				Prefix:                  "homeassistant",
+				AllocationStrategyTopic: "{{.Id}}/allocationStrategy",
+			},
 		},
 		Controller: ControllerConfig{
-			Periode:           1000 * time.Millisecond,
-			WaitTimeForInputs: 100 * time.Millisecond,
+			Periode:               1000 * time.Millisecond,
+			WaitTimeForInputs:     100 * time.Millisecond,
+			AcceptedNodeTypes:     []string{NODE_TYPE_PV, NODE_TYPE_CHARGER, NODE_TYPE_BATTERY, NODE_TYPE_METER},
+			MinimumNodeVersion:    "",
+			AllocationStrategy:    ALLOCATION_STRATEGY_EQUAL,
+			GridExportLimit:       -1,
+			CurtailmentHysteresis: 500,
+			ChargerMaximumPower:   0,
 		},
 		Charger: ChargerConfig{
 			MaximumAcceptableSetPointOffset: 1000 * time.Millisecond,
 		},
+		Pv: PvConfig{
+			MaximumAcceptableLimitOffset: 1000 * time.Millisecond,
+			StaleTimeout:                 30 * time.Second,
+		},
+		Ocpp: OcppConfig{
+			ListenAddress:     "",
+			ConnectorId:       1,
+			HeartbeatInterval: 60 * time.Second,
+			CallTimeout:       10 * time.Second,
+		},
+		SunSpec: SunSpecConfig{
+			Address:      "",
+			UnitId:       1,
+			PollInterval: 5 * time.Second,
+			Timeout:      3 * time.Second,
+		},
+	}
+}
+
+// ParseTags parses comma separated key=value pairs. A key without value gets
+// an empty value.
+func ParseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
+	return tags
 }
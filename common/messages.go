@@ -18,6 +18,49 @@ type Message struct {
 type Value struct {
 	Message
 	Value float64
+	// MeasuredAt is the time the value was measured by the device, Timestamp
+	// the time it was sent
+	MeasuredAt time.Time
+	// Quality of a measured value, empty for values which are not measured
+	Quality string
+}
+
+const (
+	QUALITY_GOOD = "good"
+	// the last measurement is older than the stale timeout
+	QUALITY_STALE = "stale"
+	// no measurement was received yet
+	QUALITY_MISSING = "missing"
+)
+
+// ProductionLimit curtails the production of a PV node to Limit W. The
+// curtailment is lifted if Curtailed is false or no new limit is received
+// until ValidUntil.
+type ProductionLimit struct {
+	Message
+	Limit      float64
+	Curtailed  bool
+	ValidUntil time.Time
+}
+
+// ChargerStatus is the telemetry reported by a charger device.
+type ChargerStatus struct {
+	// ChargingPower is the actual charging power in W
+	ChargingPower float64
+	Plugged       bool
+	// SessionEnergy is the energy charged in the current session in Wh
+	SessionEnergy float64
+	ErrorCodes    []string
+	Timestamp     time.Time
+}
+
+// ChargerMessage answers the CHARGER_ACTION with the last charging set point
+// sent to the device and the last status received from it. Status is nil if
+// the device has not reported any status yet.
+type ChargerMessage struct {
+	Message
+	SetPoint float64
+	Status   *ChargerStatus
 }
 
 const REGISTER_EVENT = "com.siemens.openswarm.register"
@@ -26,9 +69,71 @@ const REGISTER_RESPONSE_EVENT = "com.siemens.openswarm.registerresponse"
 const CHARGER_ACTION = "com.siemens.openswarm.charger"
 const PRODUCTION_ACTION = "com.siemens.openswarm.production"
 const CHARGING_SET_POINT = "com.siemens.openswarm.chargersetpoint"
+const PRODUCTION_LIMIT = "com.siemens.openswarm.productionlimit"
+const LEASE_EVENT = "com.siemens.openswarm.lease"
+const NODE_LOST_EVENT = "com.siemens.openswarm.nodelost"
+
+const (
+	NODE_TYPE_PV      = "pv"
+	NODE_TYPE_CHARGER = "charger"
+	NODE_TYPE_BATTERY = "battery"
+	NODE_TYPE_METER   = "meter"
+)
+
+const (
+	CAPABILITY_PRODUCTION         = "production"
+	CAPABILITY_CHARGING_SET_POINT = "chargingSetPoint"
+	CAPABILITY_PRODUCTION_LIMIT   = "productionLimit"
+)
+
+var CAPABILITIES = []string{CAPABILITY_PRODUCTION, CAPABILITY_CHARGING_SET_POINT, CAPABILITY_PRODUCTION_LIMIT}
+
+// the controller shares the PV production equally between the chargers,
+// further strategies are added here
+const (
+	ALLOCATION_STRATEGY_EQUAL = "equal"
+)
+
+var ALLOCATION_STRATEGIES = []string{ALLOCATION_STRATEGY_EQUAL}
 
 type DdaRegisterMessage struct {
 	NodeId    string
 	SensorId  string
 	Timestamp int64
+
+	NodeType     string
+	Version      string
+	Capabilities []string          `json:",omitempty"`
+	Tags         map[string]string `json:",omitempty"`
+	// LeaseTimeout in ms after which the leader deregisters the node without
+	// lease renewal, 0 if the node renews no leases. It is replicated with
+	// the registration, so a new leader expires the leases of nodes it never
+	// saw renewing.
+	LeaseTimeout int64 `json:",omitempty"`
+}
+
+// operations answered by a DdaRegisterResponse
+const (
+	OPERATION_REGISTER   = "register"
+	OPERATION_DEREGISTER = "deregister"
+	// a lease renewal of a node which is not registered is rejected
+	OPERATION_LEASE = "lease"
+)
+
+// DdaRegisterResponse is sent by the leader as answer to a registration or
+// deregistration of a node.
+type DdaRegisterResponse struct {
+	NodeId    string
+	Operation string
+	Accepted  bool
+	Reason    string `json:",omitempty"`
+}
+
+// DdaLeaseMessage renews the liveness lease of a node. Timeout is given in
+// milliseconds.
+type DdaLeaseMessage struct {
+	NodeId    string
+	SensorId  string
+	Timeout   int64
+	Timestamp int64
 }
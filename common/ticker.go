@@ -1,8 +1,14 @@
 package common
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
+// Ticker calls a callback immediately and then periodically. It is safe for
+// concurrent use.
 type Ticker struct {
+	mu      sync.Mutex
 	quit    chan bool
 	started bool
 }
@@ -10,18 +16,21 @@ type Ticker struct {
 func (t *Ticker) Start(duration time.Duration, callback func()) {
 	callback()
 
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	quit := make(chan bool)
 	t.started = true
-	t.quit = make(chan bool)
+	t.quit = quit
 
 	ticker := time.NewTicker(duration)
 	go func() {
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				callback()
-			case <-t.quit:
-				ticker.Stop()
-				t.started = false
+			case <-quit:
 				return
 			}
 		}
@@ -29,11 +38,10 @@ func (t *Ticker) Start(duration time.Duration, callback func()) {
 }
 
 func (t *Ticker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if t.started {
-		select {
-		case t.quit <- true:
-		default:
-		}
 		close(t.quit)
 	}
 	t.started = false
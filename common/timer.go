@@ -1,10 +1,14 @@
 package common
 
 import (
+	"sync"
 	"time"
 )
 
+// Timer calls a callback once after a duration. It is safe for concurrent
+// use, the callback may start or stop the timer again.
 type Timer struct {
+	mu    sync.Mutex
 	timer *time.Timer
 
 	quit    chan bool
@@ -12,35 +16,47 @@ type Timer struct {
 }
 
 func (t *Timer) Start(duration time.Duration, callback func()) {
-	t.started = true
-	t.quit = make(chan bool)
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	t.timer = time.NewTimer(duration)
+	quit := make(chan bool)
+	timer := time.NewTimer(duration)
+	t.started = true
+	t.quit = quit
+	t.timer = timer
 
 	go func() {
 		select {
-		case <-t.timer.C:
+		case <-timer.C:
 			callback()
-		case <-t.quit:
-			if !t.timer.Stop() {
-				<-t.timer.C
-			}
+		case <-quit:
+			timer.Stop()
 		}
-		t.started = false
+
+		// the callback may have started the timer again
+		t.mu.Lock()
+		if t.quit == quit {
+			t.started = false
+		}
+		t.mu.Unlock()
 	}()
 }
 
 func (t *Timer) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	if t.started {
-		select {
-		case t.quit <- true:
-		default:
-		}
 		close(t.quit)
 	}
 	t.started = false
 }
 
 func (t *Timer) Reset(duration time.Duration) {
-	t.timer.Reset(duration)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.timer != nil {
+		t.timer.Reset(duration)
+	}
 }
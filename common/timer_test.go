@@ -1,6 +1,7 @@
 package common
 
 import (
+	"sync"
 	"testing"
 	"time"
 )
@@ -131,3 +132,60 @@ func TestTimerResetAfterCallback(t *testing.T) {
 		t.Errorf("Wrong number of invocations after reStart: %v", count)
 	}
 }
+
+func TestTimerStopAfterRestartInsideCallback(t *testing.T) {
+	subject := Timer{}
+	count := 0
+
+	subject.Start(time.Millisecond*50, func() {
+		count++
+		subject.Start(time.Millisecond*50, func() {
+			count++
+		})
+	})
+
+	time.Sleep(time.Millisecond * 70)
+	subject.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	if count != 1 {
+		t.Errorf("Restarted timer not stopped: %v", count)
+	}
+}
+
+func TestTimerRestartAfterInvocation(t *testing.T) {
+	subject := Timer{}
+	count := 0
+
+	subject.Start(time.Millisecond*50, func() {
+		count++
+	})
+	time.Sleep(time.Millisecond * 70)
+
+	subject.Start(time.Millisecond*50, func() {
+		count++
+	})
+	time.Sleep(time.Millisecond * 70)
+
+	if count != 2 {
+		t.Errorf("Wrong number of invocations: %v", count)
+	}
+}
+
+func TestTimerConcurrentUse(t *testing.T) {
+	subject := Timer{}
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				subject.Start(time.Millisecond, func() {})
+				subject.Reset(time.Millisecond)
+				subject.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version of the node software, sent on registration. Can be set at build time
+// with -ldflags "-X code.siemens.com/energy-community-controller/common.Version=1.2.3".
+var Version = "0.1.0"
+
+// CompareVersions compares two dot separated versions numerically, e.g.
+// 1.10.0 is newer than 1.9.2. A leading v and suffixes like -rc1 are ignored.
+// It returns -1, 0 or 1 if a is older, equal or newer than b.
+func CompareVersions(a string, b string) int {
+	partsA := versionParts(a)
+	partsB := versionParts(b)
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x = partsA[i]
+		}
+		if i < len(partsB) {
+			y = partsB[i]
+		}
+
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+
+	parts := make([]int, 0)
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	return parts
+}
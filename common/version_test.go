@@ -0,0 +1,22 @@
+package common
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.10.0", "1.9.2", 1},
+		{"1.2", "1.2.1", -1},
+		{"v2.0.0-rc1", "2.0.0", 0},
+		{"0.1.0", "", 1},
+	}
+
+	for _, test := range tests {
+		if result := CompareVersions(test.a, test.b); result != test.expected {
+			t.Errorf("CompareVersions(%s, %s) = %d, expected %d", test.a, test.b, result, test.expected)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"code.siemens.com/energy-community-controller/common"
+	"code.siemens.com/energy-community-controller/controller/supervisor"
 	"code.siemens.com/energy-community-controller/dda"
 	"github.com/coatyio/dda/services/com/api"
 	stateAPI "github.com/coatyio/dda/services/state/api"
@@ -18,6 +19,7 @@ type connector struct {
 	config       common.ControllerConfig
 	ddaConnector *dda.Connector
 	state        *state
+	leases       *leases
 
 	ctx    context.Context
 	leader bool
@@ -28,6 +30,7 @@ func newConnector(config common.ControllerConfig, ddaConnector *dda.Connector, s
 		config:       config,
 		ddaConnector: ddaConnector,
 		state:        state,
+		leases:       newLeases(),
 		leader:       false,
 	}
 }
@@ -47,12 +50,21 @@ func (c *connector) start(ctx context.Context) error {
 		return err
 	}
 
+	leaseChannel, err := c.ddaConnector.SubscribeEvent(ctx, api.SubscriptionFilter{Type: common.LEASE_EVENT})
+	if err != nil {
+		return err
+	}
+
 	sc, err := c.ddaConnector.ObserveStateChange(ctx)
 	if err != nil {
 		return err
 	}
 
+	leaseTicker := time.NewTicker(c.config.Periode)
+
 	go func() {
+		defer leaseTicker.Stop()
+
 		for {
 			select {
 			case registerNode := <-registerNodeChannel:
@@ -63,7 +75,12 @@ func (c *connector) start(ctx context.Context) error {
 						log.Printf("Could not unmarshal incoming register message, %s", err)
 						continue
 					}
-					c.writeNodeToLog(msg.NodeId, msg.SensorId)
+					if accepted, reason := validateRegistration(c.config, msg); !accepted {
+						log.Printf("controller - rejected registration of node %s: %s", msg.NodeId, reason)
+						c.sendRegisterResponse(common.DdaRegisterResponse{NodeId: msg.NodeId, Operation: common.OPERATION_REGISTER, Accepted: false, Reason: reason})
+						continue
+					}
+					c.writeNodeToLog(msg)
 				}
 			case deregisterNode := <-deregisterNodeChannel:
 				if c.leader {
@@ -75,9 +92,30 @@ func (c *connector) start(ctx context.Context) error {
 					}
 					c.removeNodeFromLog(msg.NodeId, msg.SensorId)
 				}
+			case leaseRenewal := <-leaseChannel:
+				// every controller records the renewals, so a new leader knows
+				// the leases, but only the leader expires them
+				var msg common.DdaLeaseMessage
+				if err := json.Unmarshal(leaseRenewal.Data, &msg); err != nil {
+					log.Printf("Could not unmarshal incoming lease message, %s", err)
+					continue
+				}
+				if !c.state.registered(msg.NodeId) {
+					if c.leader {
+						log.Printf("controller - rejected lease renewal of node %s, it is not registered", msg.NodeId)
+						c.sendRegisterResponse(common.DdaRegisterResponse{NodeId: msg.NodeId, Operation: common.OPERATION_LEASE, Accepted: false, Reason: "not registered"})
+					}
+					continue
+				}
+				c.leases.observe(msg, time.Now())
+			case <-leaseTicker.C:
+				if c.leader {
+					c.expireLeases()
+				}
 			case v := <-leaderChannel:
 				if v {
 					c.leader = true
+					c.leases.rebuild(c.state.registeredNodes(), time.Now())
 				} else {
 					c.leader = false
 				}
@@ -86,32 +124,40 @@ func (c *connector) start(ctx context.Context) error {
 					continue
 				}
 
-				sensorId := string(stateChange.Value)
 				nodeId := strings.TrimPrefix(stateChange.Key, NODE_PREFIX)
 
 				if stateChange.Op == stateAPI.InputOpSet {
+					node := decodeNode(nodeId, stateChange.Value)
+					c.state.setNode(node)
+					sensorId := node.SensorId
 					if _, ok := c.state.topology[sensorId]; !ok {
 						c.state.topology[sensorId] = make([]string, 1)
 					}
 					c.state.topology[sensorId] = append(c.state.topology[sensorId], nodeId)
 				} else {
-					if _, ok := c.state.topology[sensorId]; !ok {
-						continue
-					}
-					for i, id := range c.state.topology[sensorId] {
-						if id == nodeId {
-							c.state.topology[sensorId] = append(c.state.topology[sensorId][:i], c.state.topology[sensorId][i+1:]...)
-							break
+					c.state.removeNode(nodeId)
+					c.leases.remove(nodeId)
+					// deletions carry no value, so the sensor of the node is unknown
+					for sensorId, nodeIds := range c.state.topology {
+						for i, id := range nodeIds {
+							if id == nodeId {
+								c.state.topology[sensorId] = append(nodeIds[:i], nodeIds[i+1:]...)
+								break
+							}
 						}
-					}
 
-					if len(c.state.topology[sensorId]) == 0 {
-						delete(c.state.topology, sensorId)
+						if len(c.state.topology[sensorId]) == 0 {
+							delete(c.state.topology, sensorId)
+						}
 					}
 				}
 
 				if c.leader {
-					c.ddaConnector.PublishEvent(api.Event{Type: common.REGISTER_RESPONSE_EVENT, Source: "controller", Id: uuid.NewString(), Data: []byte(nodeId)})
+					response := common.DdaRegisterResponse{NodeId: nodeId, Operation: common.OPERATION_REGISTER, Accepted: true}
+					if stateChange.Op != stateAPI.InputOpSet {
+						response.Operation = common.OPERATION_DEREGISTER
+					}
+					c.sendRegisterResponse(response)
 				}
 			}
 		}
@@ -143,7 +189,7 @@ func (c *connector) getData() {
 		}
 
 		c.state.pvProductionValues = make([]common.Value, 0)
-		c.state.chargerIds = make([]common.Message, 0)
+		c.state.chargers = make([]common.ChargerMessage, 0)
 
 		// to get an "AfterEqual()", subtract the minimal timeresolution of message timestamps (unix time - which are in seconds)
 		startTime := time.Now().Add(-1 * time.Second)
@@ -155,6 +201,11 @@ func (c *connector) getData() {
 					continue
 				}
 
+				if c.config.IgnoreUnregisteredNodes && !c.state.registered(value.Id) {
+					log.Printf("controller - ignoring production of %s, it is not registered", value.Id)
+					continue
+				}
+
 				if value.Timestamp.After(startTime) {
 					c.state.pvProductionValues = append(c.state.pvProductionValues, value)
 				}
@@ -163,14 +214,19 @@ func (c *connector) getData() {
 
 		go func() {
 			for chargerResponse := range chargerResponses {
-				var msg common.Message
+				var msg common.ChargerMessage
 				if err := json.Unmarshal(chargerResponse.Data, &msg); err != nil {
 					log.Printf("Could not unmarshal incoming charger message, %s", err)
 					continue
 				}
 
+				if c.config.IgnoreUnregisteredNodes && !c.state.registered(msg.Id) {
+					log.Printf("controller - ignoring charger %s, it is not registered", msg.Id)
+					continue
+				}
+
 				if msg.Timestamp.After(startTime) {
-					c.state.chargerIds = append(c.state.chargerIds, msg)
+					c.state.chargers = append(c.state.chargers, msg)
 				}
 			}
 		}()
@@ -178,15 +234,19 @@ func (c *connector) getData() {
 		<-time.After(c.config.WaitTimeForInputs)
 		cancel()
 
-		addEvent("dataReceived")
+		addEvent(supervisor.EventDataReceived)
 	}()
 }
 
-func (c *connector) writeNodeToLog(nodeId string, sensorId string) error {
+// writeNodeToLog stores the registration of a node including its
+// capabilities and tags.
+func (c *connector) writeNodeToLog(registration common.DdaRegisterMessage) error {
+	value, _ := json.Marshal(registration)
+
 	input := stateAPI.Input{
 		Op:    stateAPI.InputOpSet,
-		Key:   NODE_PREFIX + nodeId,
-		Value: []byte(sensorId),
+		Key:   NODE_PREFIX + registration.NodeId,
+		Value: value,
 	}
 
 	return c.ddaConnector.ProposeInput(c.ctx, &input)
@@ -211,4 +271,13 @@ func (c *connector) sendChargingSetPoints() {
 	}
 }
 
+func (c *connector) sendProductionLimits() {
+	for _, limit := range c.state.productionLimits {
+		data, _ := json.Marshal(limit)
+		if err := c.ddaConnector.PublishEvent(api.Event{Type: common.PRODUCTION_LIMIT, Source: "ddaConsistencyProvider", Id: uuid.NewString(), Data: data}); err != nil {
+			log.Printf("could not send production limit - %s", err)
+		}
+	}
+}
+
 const NODE_PREFIX = "node_"
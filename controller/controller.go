@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
 	"code.siemens.com/energy-community-controller/common"
 	"code.siemens.com/energy-community-controller/dda"
@@ -13,7 +15,11 @@ type Controller struct {
 }
 
 func NewController(config common.ControllerConfig, ddaConnector *dda.Connector) (*Controller, error) {
-	state := &state{pvProductionValues: []common.Value{}, chargerIds: []common.Message{}, setPoints: []common.Value{}, topology: make(map[string][]string)}
+	if !slices.Contains(common.ALLOCATION_STRATEGIES, config.AllocationStrategy) {
+		return nil, fmt.Errorf("unknown allocation strategy %q", config.AllocationStrategy)
+	}
+
+	state := &state{pvProductionValues: []common.Value{}, chargers: []common.ChargerMessage{}, setPoints: []common.Value{}, topology: make(map[string][]string), nodes: make(map[string]common.DdaRegisterMessage)}
 	connector := newConnector(config, ddaConnector, state)
 	logic, err := newLogic(config, connector, state)
 	if err != nil {
@@ -35,3 +41,21 @@ func (c *Controller) Start(ctx context.Context) error {
 
 	return nil
 }
+
+// Stop finishes the allocation round in progress and starts no further
+// rounds. Call it before the leadership is handed over, so the successor does
+// not allocate concurrently.
+func (c *Controller) Stop(ctx context.Context) error {
+	return c.logic.stop(ctx)
+}
+
+// SetAllocationStrategy changes the allocation strategy at runtime, it applies
+// from the next round.
+func (c *Controller) SetAllocationStrategy(strategy string) error {
+	if !slices.Contains(common.ALLOCATION_STRATEGIES, strategy) {
+		return fmt.Errorf("unknown allocation strategy %q", strategy)
+	}
+
+	c.logic.setAllocationStrategy(strategy)
+	return nil
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+// absorbablePower is the power the chargers can take of their set points.
+// Chargers reporting that no vehicle is plugged in take nothing.
+func absorbablePower(chargers []common.ChargerMessage, setPoints []common.Value) float64 {
+	var absorbable float64
+	for i, setPoint := range setPoints {
+		if i < len(chargers) && chargers[i].Status != nil && !chargers[i].Status.Plugged {
+			continue
+		}
+		absorbable += setPoint.Value
+	}
+	return absorbable
+}
+
+// limitTolerance is the fraction of its limit below which the production of a
+// curtailed node is not considered limited by the curtailment anymore.
+const limitTolerance = 0.05
+
+// calculateProductionLimits curtails the PV nodes in proportion to their
+// production if the surplus over the absorbable power exceeds exportLimit.
+// A curtailed node measures at most its limit, so the curtailment of the
+// previous round is kept while a node produces at or near its limit and only
+// lifted when the surplus drops more than hysteresis below exportLimit. Nodes
+// curtailed in the previous round but left out of this one are lifted.
+func calculateProductionLimits(production []common.Value, previous []common.ProductionLimit, absorbable float64, exportLimit float64, hysteresis float64) []common.ProductionLimit {
+	var sumPvProduction float64
+	for _, productionValue := range production {
+		sumPvProduction += productionValue.Value
+	}
+
+	previousLimits := make(map[string]common.ProductionLimit, len(previous))
+	for _, limit := range previous {
+		if limit.Curtailed {
+			previousLimits[limit.Id] = limit
+		}
+	}
+
+	atLimit := false
+	for _, productionValue := range production {
+		if limit, ok := previousLimits[productionValue.Id]; ok && productionValue.Value >= limit.Limit*(1-limitTolerance) {
+			atLimit = true
+		}
+	}
+
+	surplus := sumPvProduction - absorbable
+	curtailed := exportLimit >= 0 && sumPvProduction > 0 &&
+		(surplus > exportLimit || (len(previousLimits) > 0 && (atLimit || surplus > exportLimit-hysteresis)))
+
+	limits := make([]common.ProductionLimit, len(production))
+	for i, productionValue := range production {
+		limits[i] = common.ProductionLimit{Message: common.Message{Id: productionValue.Id, Timestamp: time.Now()}, Curtailed: curtailed}
+		if curtailed {
+			limits[i].Limit = productionValue.Value * (absorbable + exportLimit) / sumPvProduction
+		}
+		delete(previousLimits, productionValue.Id)
+	}
+
+	for id := range previousLimits {
+		limits = append(limits, common.ProductionLimit{Message: common.Message{Id: id, Timestamp: time.Now()}, Curtailed: false})
+	}
+
+	return limits
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func production(values map[string]float64) []common.Value {
+	var production []common.Value
+	for id, value := range values {
+		production = append(production, common.Value{Message: common.Message{Id: id}, Value: value})
+	}
+	return production
+}
+
+func TestAbsorbablePower(t *testing.T) {
+	chargers := []common.ChargerMessage{
+		{Message: common.Message{Id: "c1"}},
+		{Message: common.Message{Id: "c2"}, Status: &common.ChargerStatus{Plugged: true}},
+		{Message: common.Message{Id: "c3"}, Status: &common.ChargerStatus{Plugged: false}},
+	}
+	setPoints := []common.Value{{Value: 1000}, {Value: 2000}, {Value: 4000}}
+
+	if absorbable := absorbablePower(chargers, setPoints); absorbable != 3000 {
+		t.Errorf("Wrong absorbable power: %f", absorbable)
+	}
+}
+
+func TestCalculateProductionLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		absorbable  float64
+		exportLimit float64
+		curtailed   bool
+		limits      map[string]float64
+	}{
+		{"no export limit", 0, -1, false, nil},
+		{"surplus absorbed", 6000, 0, false, nil},
+		{"surplus within export limit", 4000, 2000, false, nil},
+		{"zero export", 3000, 0, true, map[string]float64{"pv1": 1000, "pv2": 2000}},
+		{"export limit exceeded", 3000, 1500, true, map[string]float64{"pv1": 1500, "pv2": 3000}},
+	}
+
+	for _, test := range tests {
+		limits := calculateProductionLimits(production(map[string]float64{"pv1": 2000, "pv2": 4000}), nil, test.absorbable, test.exportLimit, 500)
+		if len(limits) != 2 {
+			t.Fatalf("%s: wrong number of limits: %d", test.name, len(limits))
+		}
+
+		for _, limit := range limits {
+			if limit.Curtailed != test.curtailed {
+				t.Errorf("%s: wrong curtailment of %s: %t", test.name, limit.Id, limit.Curtailed)
+			}
+			if test.curtailed && limit.Limit != test.limits[limit.Id] {
+				t.Errorf("%s: wrong limit of %s: %f", test.name, limit.Id, limit.Limit)
+			}
+		}
+	}
+}
+
+func TestNoCurtailmentWithoutProduction(t *testing.T) {
+	limits := calculateProductionLimits(production(map[string]float64{"pv1": 0}), nil, 0, 0, 500)
+	if len(limits) != 1 || limits[0].Curtailed {
+		t.Errorf("Curtailed without production: %+v", limits)
+	}
+}
+
+func TestCurtailmentOverRounds(t *testing.T) {
+	potential := map[string]float64{"pv1": 4000, "pv2": 2000}
+	var limits []common.ProductionLimit
+
+	// every round measures the production limited by the previous round
+	round := func(absorbable float64) {
+		measured := map[string]float64{}
+		for id, value := range potential {
+			measured[id] = value
+			for _, limit := range limits {
+				if limit.Id == id && limit.Curtailed {
+					measured[id] = min(value, limit.Limit)
+				}
+			}
+		}
+		limits = calculateProductionLimits(production(measured), limits, absorbable, 0, 500)
+	}
+
+	for i := 0; i < 5; i++ {
+		round(3000)
+		for _, limit := range limits {
+			if !limit.Curtailed || limit.Limit != potential[limit.Id]/2 {
+				t.Fatalf("Round %d: wrong limit of %s: %+v", i, limit.Id, limit)
+			}
+		}
+	}
+
+	// the limits are raised while the nodes produce at their limit
+	round(7000)
+	for _, limit := range limits {
+		if !limit.Curtailed || limit.Limit <= potential[limit.Id] {
+			t.Fatalf("Limit of %s not raised: %+v", limit.Id, limit)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		round(7000)
+		for _, limit := range limits {
+			if limit.Curtailed {
+				t.Fatalf("Round %d: curtailment of %s not lifted: %+v", i, limit.Id, limit)
+			}
+		}
+	}
+}
+
+func TestCurtailmentHysteresis(t *testing.T) {
+	previous := []common.ProductionLimit{{Message: common.Message{Id: "pv1"}, Limit: 5000, Curtailed: true}}
+
+	// the node produces below its limit, the surplus is within the hysteresis
+	limits := calculateProductionLimits(production(map[string]float64{"pv1": 3000}), previous, 3200, 0, 500)
+	if !limits[0].Curtailed {
+		t.Errorf("Curtailment lifted within the hysteresis: %+v", limits[0])
+	}
+
+	limits = calculateProductionLimits(production(map[string]float64{"pv1": 3000}), previous, 3600, 0, 500)
+	if limits[0].Curtailed {
+		t.Errorf("Curtailment not lifted below the hysteresis: %+v", limits[0])
+	}
+}
+
+func TestCurtailmentLiftedForLeftOutNodes(t *testing.T) {
+	previous := []common.ProductionLimit{
+		{Message: common.Message{Id: "pv1"}, Limit: 1000, Curtailed: true},
+		{Message: common.Message{Id: "pv2"}, Limit: 2000, Curtailed: true},
+	}
+
+	limits := calculateProductionLimits(production(map[string]float64{"pv1": 1000}), previous, 0, 0, 500)
+	if len(limits) != 2 || limits[1].Id != "pv2" || limits[1].Curtailed {
+		t.Errorf("Curtailment of left out node not lifted: %+v", limits)
+	}
+}
+
+func TestUsableProduction(t *testing.T) {
+	values := []common.Value{
+		{Message: common.Message{Id: "good"}, Value: 1000, Quality: common.QUALITY_GOOD},
+		{Message: common.Message{Id: "unknown"}, Value: 2000},
+		{Message: common.Message{Id: "stale"}, Value: 4000, Quality: common.QUALITY_STALE},
+		{Message: common.Message{Id: "missing"}, Quality: common.QUALITY_MISSING},
+	}
+
+	usable := usableProduction(values)
+	if len(usable) != 2 || usable[0].Id != "good" || usable[1].Id != "unknown" {
+		t.Errorf("Wrong usable production: %+v", usable)
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/coatyio/dda/services/com/api"
+	"github.com/google/uuid"
+)
+
+// leases tracks the liveness leases of the registered nodes in memory. Only
+// the lease timeout is replicated with the registration, expiry is based on
+// the local time a renewal was observed, so clocks of the nodes do not need to
+// be synchronized.
+type leases struct {
+	lastSeen map[string]time.Time
+	leases   map[string]common.DdaLeaseMessage
+}
+
+func newLeases() *leases {
+	return &leases{lastSeen: make(map[string]time.Time), leases: make(map[string]common.DdaLeaseMessage)}
+}
+
+// observe records a lease renewal.
+func (l *leases) observe(lease common.DdaLeaseMessage, now time.Time) {
+	l.lastSeen[lease.NodeId] = now
+	l.leases[lease.NodeId] = lease
+}
+
+// remove stops tracking the lease of a deregistered node.
+func (l *leases) remove(nodeId string) {
+	delete(l.lastSeen, nodeId)
+	delete(l.leases, nodeId)
+}
+
+// expired returns the leases which were not renewed within their timeout.
+func (l *leases) expired(now time.Time) []common.DdaLeaseMessage {
+	expired := make([]common.DdaLeaseMessage, 0)
+	for nodeId, lease := range l.leases {
+		if now.Sub(l.lastSeen[nodeId]) > time.Duration(lease.Timeout)*time.Millisecond {
+			expired = append(expired, lease)
+		}
+	}
+	return expired
+}
+
+// rebuild grants all leases a full timeout after a leader change, as the
+// renewals seen by the previous leader are unknown. Registered nodes with a
+// lease timeout whose renewals were never observed get a lease as well, so
+// a node which died around the leader change is expired.
+func (l *leases) rebuild(nodes []common.DdaRegisterMessage, now time.Time) {
+	for _, node := range nodes {
+		if _, ok := l.leases[node.NodeId]; !ok && node.LeaseTimeout > 0 {
+			l.leases[node.NodeId] = common.DdaLeaseMessage{NodeId: node.NodeId, SensorId: node.SensorId, Timeout: node.LeaseTimeout}
+		}
+	}
+
+	for nodeId := range l.leases {
+		l.lastSeen[nodeId] = now
+	}
+}
+
+// expireLeases deregisters all nodes with an expired lease and publishes a
+// node lost event for each of them.
+func (c *connector) expireLeases() {
+	for _, lease := range c.leases.expired(time.Now()) {
+		log.Printf("controller - lease of node %s expired, deregistering it", lease.NodeId)
+
+		if err := c.removeNodeFromLog(lease.NodeId, lease.SensorId); err != nil {
+			log.Printf("controller - could not deregister node %s: %s", lease.NodeId, err)
+			continue
+		}
+		c.leases.remove(lease.NodeId)
+
+		c.nodeLost(lease)
+	}
+}
+
+// nodeLost informs other components about a lost node. The allocation drops
+// the node once its deregistration is applied to the replicated state.
+func (c *connector) nodeLost(lease common.DdaLeaseMessage) {
+	data, _ := json.Marshal(common.DdaRegisterMessage{NodeId: lease.NodeId, SensorId: lease.SensorId, Timestamp: time.Now().Unix()})
+	if err := c.ddaConnector.PublishEvent(api.Event{Type: common.NODE_LOST_EVENT, Source: "controller", Id: uuid.NewString(), Data: data}); err != nil {
+		log.Printf("controller - could not publish node lost event - %s", err)
+	}
+}
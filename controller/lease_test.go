@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func lease(nodeId string, timeout time.Duration) common.DdaLeaseMessage {
+	return common.DdaLeaseMessage{NodeId: nodeId, SensorId: "sensor", Timeout: timeout.Milliseconds()}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	l := newLeases()
+	start := time.Now()
+
+	l.observe(lease("a", 10*time.Second), start)
+	l.observe(lease("b", 10*time.Second), start)
+
+	if expired := l.expired(start.Add(5 * time.Second)); len(expired) != 0 {
+		t.Errorf("Leases expired too early: %v", expired)
+	}
+
+	l.observe(lease("b", 10*time.Second), start.Add(5*time.Second))
+
+	expired := l.expired(start.Add(11 * time.Second))
+	if len(expired) != 1 || expired[0].NodeId != "a" {
+		t.Errorf("Wrong leases expired: %v", expired)
+	}
+
+	l.remove("a")
+	if expired := l.expired(start.Add(20 * time.Second)); len(expired) != 1 || expired[0].NodeId != "b" {
+		t.Errorf("Removed lease still tracked: %v", expired)
+	}
+}
+
+func TestLeaseRenewOnLeaderChange(t *testing.T) {
+	l := newLeases()
+	start := time.Now()
+
+	l.observe(lease("a", 10*time.Second), start)
+	l.rebuild(nil, start.Add(8*time.Second))
+
+	if expired := l.expired(start.Add(15 * time.Second)); len(expired) != 0 {
+		t.Errorf("Lease expired despite grace period: %v", expired)
+	}
+}
+
+func TestLeaseRebuildFromRegistrations(t *testing.T) {
+	l := newLeases()
+	start := time.Now()
+
+	// the renewals of b were only seen by the previous leader, c renews no
+	// leases
+	l.observe(lease("a", 10*time.Second), start)
+	nodes := []common.DdaRegisterMessage{
+		{NodeId: "a", SensorId: "sensor", LeaseTimeout: 10000},
+		{NodeId: "b", SensorId: "sensor", LeaseTimeout: 10000},
+		{NodeId: "c", SensorId: "sensor"},
+	}
+	l.rebuild(nodes, start.Add(5*time.Second))
+
+	if expired := l.expired(start.Add(14 * time.Second)); len(expired) != 0 {
+		t.Errorf("Leases expired before a full timeout after the leader change: %v", expired)
+	}
+
+	l.observe(lease("a", 10*time.Second), start.Add(14*time.Second))
+	expired := l.expired(start.Add(16 * time.Second))
+	if len(expired) != 1 || expired[0].NodeId != "b" || expired[0].SensorId != "sensor" {
+		t.Errorf("Lease of the node which died around the leader change not expired: %v", expired)
+	}
+}
@@ -2,60 +2,61 @@ package controller
 
 import (
 	"context"
-	"fmt"
-	"io"
 	"log"
-	"os"
+	"sync"
 	"time"
 
 	"code.siemens.com/energy-community-controller/common"
+	"code.siemens.com/energy-community-controller/controller/supervisor"
 	"code.siemens.com/energy-community-controller/sct"
 )
 
+//go:generate go run ../cmd/sctgen -p supervisor -o supervisor/supervisor.go ../resources/simpleController1.xml ../resources/simpleController2.xml
+
 var eventChannel chan string
 
 func addEvent(event string) {
 	eventChannel <- event
 }
 
+var _ supervisor.Callbacks = (*logic)(nil)
+
 type logic struct {
 	config    common.ControllerConfig
 	connector *connector
 	state     *state
 	sct       *sct.SCT
-}
+	ticker    common.Ticker
 
-func newLogic(config common.ControllerConfig, connector *connector, state *state) (*logic, error) {
-	l := logic{config: config, connector: connector, state: state}
+	// roundDone is closed when the current round has sent its set points, it
+	// is nil between rounds. No rounds are started once stopped.
+	roundMu   sync.Mutex
+	roundDone chan struct{}
+	stopped   bool
 
-	s1, err := os.Open("resources/simpleController1.xml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
-	}
-	defer s1.Close()
+	// allocationStrategy can be changed at runtime, it is read once per round
+	strategyMu         sync.Mutex
+	allocationStrategy string
+}
 
-	s2, err := os.Open("resources/simpleController2.xml")
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %v", err)
-	}
-	defer s2.Close()
+func newLogic(config common.ControllerConfig, connector *connector, state *state) (*logic, error) {
+	l := logic{config: config, connector: connector, state: state, allocationStrategy: config.AllocationStrategy}
 
-	callbacks := make(map[string]func())
-	callbacks["calculateEqualAllocationSetPoints"] = l.calculateChargerPower
-	callbacks["getData"] = connector.getData
-	callbacks["sendSetPoints"] = connector.sendChargingSetPoints
-	if sct, err := sct.NewSCT([]io.Reader{s1, s2}, callbacks); err != nil {
+	if sct, err := sct.NewSCTFromModels(supervisor.Models, supervisor.CallbackMap(&l)); err != nil {
 		return nil, err
 	} else {
 		l.sct = sct
 	}
 
+	l.sct.OnDisabledEvent(func(supervisor string, event string) {
+		log.Printf("controller - WARNING uncontrollable event %s is disabled in supervisor %s (%d so far), the plant model is wrong", event, supervisor, l.sct.DisabledEventsCount())
+	})
+
 	return &l, nil
 }
 
 func (l *logic) start(ctx context.Context) error {
 	eventChannel = make(chan string, 100)
-	var ticker common.Ticker
 
 	l.sct.Start(ctx)
 
@@ -65,16 +66,16 @@ func (l *logic) start(ctx context.Context) error {
 			case v := <-l.connector.leaderCh(ctx):
 				if v {
 					log.Println("controller - I'm leader, starting logic")
-					ticker.Start(l.config.Periode, l.newRound)
+					l.ticker.Start(l.config.Periode, l.newRound)
 				} else {
 					log.Println("controller - lost leadership, stop logic")
-					ticker.Stop()
+					l.ticker.Stop()
 				}
 			case event := <-eventChannel:
 				l.sct.AddEvent(event)
 			case <-ctx.Done():
 				log.Printf("controller - shutdown leader channel observer")
-				ticker.Stop()
+				l.ticker.Stop()
 				return
 			}
 		}
@@ -84,29 +85,148 @@ func (l *logic) start(ctx context.Context) error {
 }
 
 func (l *logic) newRound() {
-	addEvent("newRound")
+	l.roundMu.Lock()
+	if l.stopped {
+		l.roundMu.Unlock()
+		return
+	}
+	if l.roundDone == nil {
+		l.roundDone = make(chan struct{})
+	}
+	l.roundMu.Unlock()
+
+	addEvent(supervisor.EventNewRound)
+}
+
+func (l *logic) finishRound() {
+	l.roundMu.Lock()
+	defer l.roundMu.Unlock()
+
+	if l.roundDone != nil {
+		close(l.roundDone)
+		l.roundDone = nil
+	}
+}
+
+// stop starts no further rounds and waits until the current round has sent
+// its set points or ctx is done.
+func (l *logic) stop(ctx context.Context) error {
+	l.roundMu.Lock()
+	l.stopped = true
+	roundDone := l.roundDone
+	l.roundMu.Unlock()
+
+	l.ticker.Stop()
+
+	if roundDone == nil {
+		return nil
+	}
+
+	log.Println("controller - waiting for the current round to finish")
+	select {
+	case <-roundDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *logic) GetData() {
+	l.connector.getData()
 }
 
-func (l *logic) calculateChargerPower() {
+// setAllocationStrategy changes the allocation strategy from the next round.
+func (l *logic) setAllocationStrategy(strategy string) {
+	l.strategyMu.Lock()
+	defer l.strategyMu.Unlock()
+
+	log.Printf("controller - allocation strategy %s from the next round", strategy)
+	l.allocationStrategy = strategy
+}
+
+func (l *logic) CalculateEqualAllocationSetPoints() {
+	l.strategyMu.Lock()
+	strategy := l.allocationStrategy
+	l.strategyMu.Unlock()
+
+	if strategy != common.ALLOCATION_STRATEGY_EQUAL {
+		log.Printf("controller - WARNING allocation strategy %s is not implemented, allocating equally", strategy)
+	}
+
+	// the measurements are filtered once per round, the dropped ones are
+	// logged once
+	production := usableProduction(l.state.pvProductionValues)
+	l.calculateChargerPower(production)
+	l.calculateCurtailment(production)
+}
+
+func (l *logic) SendSetPoints() {
+	l.connector.sendChargingSetPoints()
+	l.connector.sendProductionLimits()
+	l.finishRound()
+}
+
+func (l *logic) calculateChargerPower(production []common.Value) {
 	log.Println("controller -", l.state.pvProductionValues)
-	log.Println("controller -", l.state.chargerIds)
+	for _, charger := range l.state.chargers {
+		if charger.Status == nil {
+			log.Printf("controller - charger %s: set point %.0f W, no status", charger.Id, charger.SetPoint)
+			continue
+		}
+		log.Printf("controller - charger %s: set point %.0f W, charging %.0f W, plugged %t, errors %v", charger.Id, charger.SetPoint, charger.Status.ChargingPower, charger.Status.Plugged, charger.Status.ErrorCodes)
+	}
 
 	var sumPvProduction float64
-	for _, productionValue := range l.state.pvProductionValues {
+	for _, productionValue := range production {
 		sumPvProduction += productionValue.Value
 	}
 
 	var chargingSetPoint float64
-	numChargers := len(l.state.chargerIds)
+	numChargers := len(l.state.chargers)
 	if numChargers > 0 {
-		chargingSetPoint = sumPvProduction / float64(len(l.state.chargerIds))
+		chargingSetPoint = sumPvProduction / float64(len(l.state.chargers))
 	} else {
 		chargingSetPoint = 0
 	}
 
-	l.state.setPoints = make([]common.Value, len(l.state.chargerIds))
+	if l.config.ChargerMaximumPower > 0 {
+		chargingSetPoint = min(chargingSetPoint, l.config.ChargerMaximumPower)
+	}
+
+	l.state.setPoints = make([]common.Value, len(l.state.chargers))
 
-	for i, charger := range l.state.chargerIds {
+	for i, charger := range l.state.chargers {
 		l.state.setPoints[i] = common.Value{Message: common.Message{Id: charger.Id, Timestamp: time.Now()}, Value: chargingSetPoint}
 	}
 }
+
+// limitValidityPeriodes is the number of rounds a production limit stays in
+// force without being renewed, so a lost leader does not curtail forever.
+const limitValidityPeriodes = 3
+
+func (l *logic) calculateCurtailment(production []common.Value) {
+	absorbable := absorbablePower(l.state.chargers, l.state.setPoints)
+	l.state.productionLimits = calculateProductionLimits(production, l.state.productionLimits, absorbable, l.config.GridExportLimit, l.config.CurtailmentHysteresis)
+
+	validUntil := time.Now().Add(limitValidityPeriodes * l.config.Periode)
+	for i, limit := range l.state.productionLimits {
+		l.state.productionLimits[i].ValidUntil = validUntil
+		if limit.Curtailed {
+			log.Printf("controller - curtailing PV %s to %.0f W, chargers absorb %.0f W", limit.Id, limit.Limit, absorbable)
+		}
+	}
+}
+
+// usableProduction drops stale and missing measurements, the energy of these
+// producers is not allocated and they are not curtailed.
+func usableProduction(values []common.Value) []common.Value {
+	usable := make([]common.Value, 0, len(values))
+	for _, value := range values {
+		if value.Quality != "" && value.Quality != common.QUALITY_GOOD {
+			log.Printf("controller - ignoring %s production of %s, measured at %s", value.Quality, value.Id, value.MeasuredAt)
+			continue
+		}
+		usable = append(usable, value)
+	}
+	return usable
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStopWaitsForRound(t *testing.T) {
+	l := &logic{roundDone: make(chan struct{})}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l.finishRound()
+	}()
+
+	start := time.Now()
+	if err := l.stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Stopped before the round finished")
+	}
+
+	// no round is started once stopped
+	l.newRound()
+	if l.roundDone != nil {
+		t.Errorf("Round started after stop")
+	}
+}
+
+func TestStopDeadline(t *testing.T) {
+	l := &logic{roundDone: make(chan struct{})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := l.stop(ctx); err == nil {
+		t.Errorf("Stop did not give up at the deadline")
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/coatyio/dda/services/com/api"
+	"github.com/google/uuid"
+)
+
+// validateRegistration checks whether a node may join the energy community.
+// It returns the reason if the node is rejected.
+func validateRegistration(config common.ControllerConfig, registration common.DdaRegisterMessage) (bool, string) {
+	if registration.NodeId == "" {
+		return false, "node id missing"
+	}
+
+	if !slices.Contains(config.AcceptedNodeTypes, registration.NodeType) {
+		return false, fmt.Sprintf("node type %q not accepted", registration.NodeType)
+	}
+
+	if config.MinimumNodeVersion != "" && common.CompareVersions(registration.Version, config.MinimumNodeVersion) < 0 {
+		return false, fmt.Sprintf("version %q is older than the minimum version %s", registration.Version, config.MinimumNodeVersion)
+	}
+
+	for _, capability := range registration.Capabilities {
+		if !slices.Contains(common.CAPABILITIES, capability) {
+			return false, fmt.Sprintf("capability %q unknown", capability)
+		}
+	}
+
+	for key := range registration.Tags {
+		if key == "" {
+			return false, "tag without key"
+		}
+	}
+
+	return true, ""
+}
+
+// decodeNode returns the registration stored in the node_ key of a node. Older
+// entries only contain the sensor id.
+func decodeNode(nodeId string, value []byte) common.DdaRegisterMessage {
+	var node common.DdaRegisterMessage
+	if err := json.Unmarshal(value, &node); err != nil || node.NodeId != nodeId {
+		return common.DdaRegisterMessage{NodeId: nodeId, SensorId: string(value)}
+	}
+	return node
+}
+
+func (c *connector) sendRegisterResponse(response common.DdaRegisterResponse) {
+	data, _ := json.Marshal(response)
+	if err := c.ddaConnector.PublishEvent(api.Event{Type: common.REGISTER_RESPONSE_EVENT, Source: "controller", Id: uuid.NewString(), Data: data}); err != nil {
+		log.Printf("controller - could not send register response - %s", err)
+	}
+}
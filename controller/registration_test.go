@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestValidateRegistration(t *testing.T) {
+	config := common.NewConfig().Controller
+	config.MinimumNodeVersion = "1.2.0"
+
+	tests := []struct {
+		registration common.DdaRegisterMessage
+		accepted     bool
+	}{
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_CHARGER, Version: "1.2.0"}, true},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_METER, Version: "1.10.1"}, true},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: "heatpump", Version: "1.2.0"}, false},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_PV, Version: "1.1.9"}, false},
+		{common.DdaRegisterMessage{NodeType: common.NODE_TYPE_PV, Version: "1.2.0"}, false},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_PV, Version: "1.2.0", Capabilities: []string{common.CAPABILITY_PRODUCTION}, Tags: map[string]string{"site": "north"}}, true},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_PV, Version: "1.2.0", Capabilities: []string{"teleport"}}, false},
+		{common.DdaRegisterMessage{NodeId: "a", NodeType: common.NODE_TYPE_PV, Version: "1.2.0", Tags: map[string]string{"": "north"}}, false},
+	}
+
+	for _, test := range tests {
+		if accepted, reason := validateRegistration(config, test.registration); accepted != test.accepted {
+			t.Errorf("Wrong decision for %+v: %v (%s)", test.registration, accepted, reason)
+		}
+	}
+}
+
+func TestDecodeNode(t *testing.T) {
+	value, _ := json.Marshal(common.DdaRegisterMessage{NodeId: "a", SensorId: "s", Capabilities: []string{common.CAPABILITY_PRODUCTION}, Tags: map[string]string{"site": "north"}})
+	if node := decodeNode("a", value); node.SensorId != "s" || len(node.Capabilities) != 1 || node.Tags["site"] != "north" {
+		t.Errorf("Wrong node: %+v", node)
+	}
+
+	if node := decodeNode("a", []byte("sensor")); node.NodeId != "a" || node.SensorId != "sensor" {
+		t.Errorf("Wrong node of an older entry: %+v", node)
+	}
+}
@@ -1,10 +1,51 @@
 package controller
 
-import "code.siemens.com/energy-community-controller/common"
+import (
+	"sync"
+
+	"code.siemens.com/energy-community-controller/common"
+)
 
 type state struct {
 	pvProductionValues []common.Value
-	chargerIds         []common.Message
+	chargers           []common.ChargerMessage
 	setPoints          []common.Value
+	productionLimits   []common.ProductionLimit
 	topology           map[string][]string
+
+	// registrations of the nodes, indexed by their id. They are updated from
+	// the replicated state and read by the allocation.
+	nodesMu sync.Mutex
+	nodes   map[string]common.DdaRegisterMessage
+}
+
+func (s *state) setNode(node common.DdaRegisterMessage) {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	s.nodes[node.NodeId] = node
+}
+
+func (s *state) removeNode(nodeId string) {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	delete(s.nodes, nodeId)
+}
+
+// registeredNodes returns the registrations of all nodes.
+func (s *state) registeredNodes() []common.DdaRegisterMessage {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+
+	nodes := make([]common.DdaRegisterMessage, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+func (s *state) registered(nodeId string) bool {
+	s.nodesMu.Lock()
+	defer s.nodesMu.Unlock()
+	_, ok := s.nodes[nodeId]
+	return ok
 }
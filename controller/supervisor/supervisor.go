@@ -0,0 +1,109 @@
+// Code generated by sctgen from simpleController1.xml, simpleController2.xml; DO NOT EDIT.
+
+package supervisor
+
+import "code.siemens.com/energy-community-controller/sct"
+
+const (
+	EventGetData                           = "getData"
+	EventCalculateEqualAllocationSetPoints = "calculateEqualAllocationSetPoints"
+	EventSendSetPoints                     = "sendSetPoints"
+	EventNewRound                          = "newRound"
+	EventDataReceived                      = "dataReceived"
+)
+
+// Callbacks has to be implemented by the user of the supervisors, it has one
+// method per controllable event.
+type Callbacks interface {
+	GetData()
+	CalculateEqualAllocationSetPoints()
+	SendSetPoints()
+}
+
+// CallbackMap maps the controllable events to the methods of the given
+// callbacks, as expected by sct.NewSCTFromModels.
+func CallbackMap(callbacks Callbacks) map[string]func() {
+	return map[string]func(){
+		EventGetData:                           callbacks.GetData,
+		EventCalculateEqualAllocationSetPoints: callbacks.CalculateEqualAllocationSetPoints,
+		EventSendSetPoints:                     callbacks.SendSetPoints,
+	}
+}
+
+// Models contains the transition tables of all supervisors.
+var Models = []sct.Model{
+	// simpleController1.xml (simpleController1)
+	{
+		ID: "simpleController1",
+		Data: sct.Data{
+			States: []sct.State{
+				{ID: "0", Name: "3,1,2", Initial: "False", Marked: "False"},
+				{ID: "1", Name: "2,1,1", Initial: "False", Marked: "False"},
+				{ID: "2", Name: "1,1,2", Initial: "False", Marked: "False"},
+				{ID: "3", Name: "1,1,1", Initial: "True", Marked: "True"},
+				{ID: "4", Name: "3,1,1", Initial: "False", Marked: "False"},
+				{ID: "5", Name: "2,1,2", Initial: "False", Marked: "False"},
+			},
+			Events: []sct.Event{
+				{ID: "0", Name: "getData", Controllable: "True", Observable: "True"},
+				{ID: "1", Name: "calculateEqualAllocationSetPoints", Controllable: "True", Observable: "True"},
+				{ID: "2", Name: "sendSetPoints", Controllable: "True", Observable: "True"},
+				{ID: "3", Name: "newRound", Controllable: "False", Observable: "True"},
+				{ID: "4", Name: "dataReceived", Controllable: "False", Observable: "True"},
+			},
+			Transitions: []sct.Transition{
+				{Source: "0", Target: "0", Event: "4"},
+				{Source: "0", Target: "2", Event: "2"},
+				{Source: "1", Target: "4", Event: "1"},
+				{Source: "1", Target: "1", Event: "4"},
+				{Source: "1", Target: "5", Event: "3"},
+				{Source: "2", Target: "2", Event: "4"},
+				{Source: "2", Target: "1", Event: "0"},
+				{Source: "3", Target: "3", Event: "4"},
+				{Source: "3", Target: "2", Event: "3"},
+				{Source: "4", Target: "4", Event: "4"},
+				{Source: "4", Target: "3", Event: "2"},
+				{Source: "4", Target: "0", Event: "3"},
+				{Source: "5", Target: "5", Event: "4"},
+				{Source: "5", Target: "0", Event: "1"},
+			},
+		},
+	},
+	// simpleController2.xml (simpleController2)
+	{
+		ID: "simpleController2",
+		Data: sct.Data{
+			States: []sct.State{
+				{ID: "0", Name: "2,1,1", Initial: "False", Marked: "False"},
+				{ID: "1", Name: "1,1,2", Initial: "False", Marked: "False"},
+				{ID: "2", Name: "2,1,2", Initial: "False", Marked: "False"},
+				{ID: "3", Name: "3,1,1", Initial: "False", Marked: "False"},
+				{ID: "4", Name: "3,1,2", Initial: "False", Marked: "False"},
+				{ID: "5", Name: "1,1,1", Initial: "True", Marked: "True"},
+			},
+			Events: []sct.Event{
+				{ID: "0", Name: "dataReceived", Controllable: "False", Observable: "True"},
+				{ID: "1", Name: "newRound", Controllable: "False", Observable: "True"},
+				{ID: "2", Name: "calculateEqualAllocationSetPoints", Controllable: "True", Observable: "True"},
+				{ID: "3", Name: "getData", Controllable: "True", Observable: "True"},
+				{ID: "4", Name: "sendSetPoints", Controllable: "True", Observable: "True"},
+			},
+			Transitions: []sct.Transition{
+				{Source: "0", Target: "2", Event: "0"},
+				{Source: "0", Target: "0", Event: "1"},
+				{Source: "1", Target: "1", Event: "1"},
+				{Source: "1", Target: "2", Event: "3"},
+				{Source: "2", Target: "2", Event: "1"},
+				{Source: "2", Target: "3", Event: "2"},
+				{Source: "3", Target: "4", Event: "0"},
+				{Source: "3", Target: "5", Event: "4"},
+				{Source: "3", Target: "3", Event: "1"},
+				{Source: "4", Target: "4", Event: "1"},
+				{Source: "4", Target: "1", Event: "4"},
+				{Source: "5", Target: "1", Event: "0"},
+				{Source: "5", Target: "0", Event: "3"},
+				{Source: "5", Target: "5", Event: "1"},
+			},
+		},
+	},
+}
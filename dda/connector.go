@@ -4,12 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"os"
 	"time"
 
 	"code.siemens.com/energy-community-controller/common"
 	"github.com/coatyio/dda/config"
 	"github.com/coatyio/dda/dda"
 	"github.com/coatyio/dda/services/com/api"
+	stateapi "github.com/coatyio/dda/services/state/api"
+	"github.com/coatyio/dda/services/state/raft"
 	"github.com/google/uuid"
 )
 
@@ -17,6 +20,14 @@ type Connector struct {
 	*dda.Dda
 	cfg            *common.Config
 	leaderElection *LeaderElection
+
+	// the raft binding is owned by the connector, so membership changes can
+	// be applied on the raft node
+	state       *raft.RaftBinding
+	stateConfig *config.Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewConnector(cfg *common.Config) (*Connector, error) {
@@ -30,11 +41,52 @@ func NewConnector(cfg *common.Config) (*Connector, error) {
 	ddaConfig.Apis.GrpcWeb.Disabled = true
 	ddaConfig.Cluster = cfg.EnergyCommunityId
 
+	ddaConfig.Services.Com.Auth.Username = cfg.Auth.Username
+	ddaConfig.Services.Com.Auth.Password = cfg.Auth.Password
+	ddaConfig.Services.Com.Auth.Verify = !cfg.Auth.InsecureSkipVerify
+	if cfg.Auth.CertFile != "" {
+		ddaConfig.Services.Com.Auth.Method = "tls"
+		ddaConfig.Services.Com.Auth.Cert = cfg.Auth.CertFile
+		ddaConfig.Services.Com.Auth.Key = cfg.Auth.KeyFile
+	}
+	if cfg.Auth.CaFile != "" && os.Getenv("SSL_CERT_FILE") == "" {
+		// the DDA communication has no CA option and verifies against the
+		// system roots, which are read from SSL_CERT_FILE if set. They are
+		// loaded once on the first verification, so this has to happen before
+		// the DDA client connects.
+		log.Printf("DdaClient: using %s as SSL_CERT_FILE to verify the broker", cfg.Auth.CaFile)
+		if err := os.Setenv("SSL_CERT_FILE", cfg.Auth.CaFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Leader.Enabled || cfg.Leader.Observe {
+		stateConfig := *ddaConfig
+		stateConfig.Services.State.Protocol = "raft"
+		stateConfig.Services.State.Disabled = false
+		stateConfig.Services.State.Store = cfg.Leader.DataDir
+		stateConfig.Services.State.Opts = map[string]any{
+			"snapshotInterval":  int(cfg.Leader.SnapshotInterval.Milliseconds()),
+			"snapshotThreshold": cfg.Leader.SnapshotThreshold,
+		}
+
+		// a node restarting with persisted state rejoins its cluster
+		restored, err := hasExistingState(cfg.Leader.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		if restored {
+			log.Printf("DdaClient: restoring raft state from %s", cfg.Leader.DataDir)
+		}
+		stateConfig.Services.State.Bootstrap = cfg.Leader.Enabled && cfg.Leader.Bootstrap && !restored
+		c.stateConfig = &stateConfig
+		c.state = &raft.RaftBinding{}
+	}
+
 	if cfg.Leader.Enabled {
-		ddaConfig.Services.State.Protocol = "raft"
-		ddaConfig.Services.State.Disabled = false
-		ddaConfig.Services.State.Bootstrap = cfg.Leader.Bootstrap
-		c.leaderElection = New(ddaConfig.Identity.Id, cfg.Leader.HeartbeatPeriode, cfg.Leader.HeartbeatTimeoutBase)
+		c.leaderElection = New(ddaConfig.Identity.Id, cfg.Leader.Priority, cfg.Leader.HeartbeatPeriode, cfg.Leader.HeartbeatTimeoutBase)
+	} else if cfg.Leader.Observe {
+		c.leaderElection = NewObserver(ddaConfig.Identity.Id, cfg.Leader.HeartbeatTimeoutBase)
 	}
 
 	var err error
@@ -42,6 +94,8 @@ func NewConnector(cfg *common.Config) (*Connector, error) {
 		return nil, err
 	}
 
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	return &c, nil
 }
 
@@ -50,6 +104,23 @@ func (c *Connector) Open() error {
 		return err
 	}
 
+	if c.state != nil {
+		com := comAdapter{Dda: c.Dda}
+		if !c.cfg.Leader.Enabled {
+			// observing nodes must not count for the quorum, not even until
+			// they are demoted
+			com.join = c.joinAsNonvoter
+		}
+
+		if err := c.state.Open(c.stateConfig, com); err != nil {
+			return err
+		}
+
+		if err := c.serveMembershipRequests(); err != nil {
+			return err
+		}
+	}
+
 	if c.leaderElection != nil {
 		if err := c.leaderElection.Open(c); err != nil {
 			return err
@@ -59,10 +130,58 @@ func (c *Connector) Open() error {
 	return nil
 }
 
+// LeaderCh reports whether this node is leader. Nodes which only observe the
+// leader election report every leader change as false. Without leader
+// election the channel is closed when ctx is done and never reports anything.
 func (c *Connector) LeaderCh(ctx context.Context) <-chan bool {
+	if c.leaderElection == nil {
+		leaderChannel := make(chan bool)
+		go func() {
+			<-ctx.Done()
+			close(leaderChannel)
+		}()
+		return leaderChannel
+	}
+
 	return c.leaderElection.LeaderCh(ctx)
 }
 
+// LeaderInfo returns the current leader of the energy community. It is empty
+// if this node neither takes part in nor observes the leader election.
+func (c *Connector) LeaderInfo() LeaderInfo {
+	if c.leaderElection == nil {
+		return LeaderInfo{}
+	}
+
+	return c.leaderElection.LeaderInfo()
+}
+
+// LeaderInfoCh publishes the current leader on every heartbeat. The channel is
+// closed when ctx is done.
+func (c *Connector) LeaderInfoCh(ctx context.Context) <-chan LeaderInfo {
+	if c.leaderElection == nil {
+		leaderInfoChannel := make(chan LeaderInfo)
+		go func() {
+			<-ctx.Done()
+			close(leaderInfoChannel)
+		}()
+		return leaderInfoChannel
+	}
+
+	return c.leaderElection.LeaderInfoCh(ctx)
+}
+
+// TransferLeadership hands over the leadership to another leader candidate
+// before shutting down, so set points are sent without waiting for a heartbeat
+// timeout.
+func (c *Connector) TransferLeadership(ctx context.Context) error {
+	if c.leaderElection == nil {
+		return nil
+	}
+
+	return c.leaderElection.TransferLeadership(ctx)
+}
+
 func (c *Connector) Close() {
 	log.Println("DdaClient: close")
 	if c.leaderElection != nil {
@@ -71,12 +190,45 @@ func (c *Connector) Close() {
 		time.Sleep(time.Millisecond * 50)
 	}
 
+	c.cancel()
+	if c.state != nil {
+		c.state.Close()
+	}
+
 	c.Dda.Close()
 }
 
-func (c *Connector) RegisterNode(nodeId string, sendorId string) error {
-	registerMessage := common.DdaRegisterMessage{NodeId: nodeId, SensorId: sendorId, Timestamp: time.Now().Unix()}
-	data, err := json.Marshal(registerMessage)
+// ProposeInput proposes the given input to the replicated state.
+func (c *Connector) ProposeInput(ctx context.Context, in *stateapi.Input) error {
+	if c.state == nil {
+		return errStateDisabled
+	}
+	return c.state.ProposeInput(ctx, in)
+}
+
+// ObserveStateChange emits all changes of the replicated state until ctx is
+// done.
+func (c *Connector) ObserveStateChange(ctx context.Context) (<-chan stateapi.Input, error) {
+	if c.state == nil {
+		return nil, errStateDisabled
+	}
+	return c.state.ObserveStateChange(ctx)
+}
+
+// ObserveMembershipChange emits nodes joining and leaving the raft cluster
+// until ctx is done.
+func (c *Connector) ObserveMembershipChange(ctx context.Context) (<-chan stateapi.MembershipChange, error) {
+	if c.state == nil {
+		return nil, errStateDisabled
+	}
+	return c.state.ObserveMembershipChange(ctx)
+}
+
+// RegisterNode asks the leader to add the node to the topology. The node id,
+// type and version have to be set.
+func (c *Connector) RegisterNode(registration common.DdaRegisterMessage) error {
+	registration.Timestamp = time.Now().Unix()
+	data, err := json.Marshal(registration)
 
 	if err != nil {
 		return err
@@ -99,3 +251,17 @@ func (c *Connector) DeregisterNode(nodeId string, sendorId string) error {
 	event := api.Event{Type: common.DEREGISTER_EVENT, Id: uuid.NewString(), Source: "controller", Data: data}
 	return c.Dda.PublishEvent(event)
 }
+
+// RenewLease renews the liveness lease of the node. The leader deregisters the
+// node if the lease is not renewed within timeout.
+func (c *Connector) RenewLease(nodeId string, sensorId string, timeout time.Duration) error {
+	leaseMessage := common.DdaLeaseMessage{NodeId: nodeId, SensorId: sensorId, Timeout: timeout.Milliseconds(), Timestamp: time.Now().Unix()}
+	data, err := json.Marshal(leaseMessage)
+
+	if err != nil {
+		return err
+	}
+
+	event := api.Event{Type: common.LEASE_EVENT, Id: uuid.NewString(), Source: "controller", Data: data}
+	return c.Dda.PublishEvent(event)
+}
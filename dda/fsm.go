@@ -1,7 +1,10 @@
 package dda
 
 import (
+	"context"
+	"errors"
 	"log"
+	"math"
 	"math/rand"
 	"sync"
 	"time"
@@ -14,6 +17,7 @@ type state int
 const (
 	leader state = iota
 	candidate
+	preCandidate
 	follower
 )
 
@@ -23,38 +27,63 @@ const (
 	ownHeartbeatReceived event = iota
 	differentHeartbeatReceived
 	heartbeatTimeout
+	handoverReceived
+	preVoteGranted
+	preVoteRejected
 )
 
 type transition func() state
 
+var errNoSuccessor = errors.New("no leader candidate available to take over leadership")
+
 type fsm struct {
 	id               string
+	priority         int
+	passive          bool
 	api              leaderElectionAPI
 	mu               sync.Mutex
 	heartbeatMonitor common.Timer
 	heartbeatSender  common.Ticker
+	preVoteWindow    common.Timer
+	periode          time.Duration
+	timeoutBase      time.Duration
 
 	observers      map[uint64]chan bool
 	nextObserverId uint64
 
+	infoObservers map[uint64]chan LeaderInfo
+	lastHeartbeat time.Time
+
 	currentState        state
 	transitions         map[state]map[event]transition
 	timeout             time.Duration
 	highestReceivedTerm uint64
 	currentTerm         uint64
 	currentLeader       string
+
+	// priorities of all registered leader candidates, indexed by their id
+	candidates map[string]int
+	// local time the entry of a candidate was last committed, candidates
+	// refresh it every heartbeat timeout
+	candidateSeen map[string]time.Time
 }
 
-func newFsm(id string, api leaderElectionAPI, periode time.Duration, timeoutBase time.Duration) *fsm {
+func newFsm(id string, priority int, api leaderElectionAPI, periode time.Duration, timeoutBase time.Duration) *fsm {
 	f := fsm{
 		id:                  id,
+		priority:            priority,
 		api:                 api,
+		periode:             periode,
+		timeoutBase:         timeoutBase,
 		observers:           make(map[uint64]chan bool),
+		infoObservers:       make(map[uint64]chan LeaderInfo),
 		nextObserverId:      0,
 		currentState:        follower,
 		transitions:         make(map[state]map[event]transition),
-		timeout:             getRandomTimeout(timeoutBase),
+		timeout:             getRandomTimeout(timeoutBase, priority),
 		highestReceivedTerm: 0,
+		candidates:          make(map[string]int),
+		candidateSeen:       make(map[string]time.Time),
 	}
 
 	f.transitions[leader] = map[event]transition{
@@ -67,11 +96,12 @@ func newFsm(id string, api leaderElectionAPI, periode time.Duration, timeoutBase
 			log.Println("leader election - leader: differentHeartbeatReceived --> follower")
 			f.heartbeatSender.Stop()
 			f.updateLeadership(false)
-			f.timeout = getRandomTimeout(timeoutBase)
+			f.timeout = getRandomTimeout(timeoutBase, priority)
 			f.heartbeatMonitor.Reset(f.timeout)
 			return follower
 		},
 		heartbeatTimeout: func() state {
+			// check quorum: the own heartbeats are not committed anymore
 			log.Println("leader election - leader: heartbeatTimeout --> follower")
 			f.heartbeatSender.Stop()
 			f.updateLeadership(false)
@@ -84,18 +114,58 @@ func newFsm(id string, api leaderElectionAPI, periode time.Duration, timeoutBase
 		ownHeartbeatReceived: func() state {
 			log.Println("leader election - candidate: ownHeartbeatReceived --> leader")
 			f.updateLeadership(true)
-			f.heartbeatMonitor.Start(f.timeout, f.heartbeatTimeout)
+			f.heartbeatMonitor.Reset(timeoutBase)
+			if successor, ok := f.preferredCandidate(f.priority + 1); ok {
+				log.Printf("leader election - preferred candidate %s is available, handing over leadership", successor)
+				go f.api.sendHandover(context.Background(), f.currentTerm, f.id, successor)
+			}
 			return leader
 		},
 		differentHeartbeatReceived: func() state {
 			log.Println("leader election - candidate: differentHeartbeatReceived --> follower")
 			f.heartbeatSender.Stop()
-			f.timeout = getRandomTimeout(timeoutBase)
+			f.timeout = getRandomTimeout(timeoutBase, priority)
+			f.heartbeatMonitor.Reset(f.timeout)
+			return follower
+		},
+		heartbeatTimeout: func() state {
+			// check quorum: the own heartbeats are not committed
+			log.Println("leader election - candidate: heartbeatTimeout --> follower")
+			f.heartbeatSender.Stop()
+			f.timeout = getRandomTimeout(timeoutBase, priority)
 			f.heartbeatMonitor.Start(f.timeout, f.heartbeatTimeout)
 			return follower
 		},
 	}
 
+	f.transitions[preCandidate] = map[event]transition{
+		differentHeartbeatReceived: func() state {
+			log.Println("leader election - pre-candidate: differentHeartbeatReceived --> follower")
+			f.heartbeatMonitor.Reset(f.timeout)
+			return follower
+		},
+		heartbeatTimeout: func() state {
+			log.Println("leader election - pre-candidate: heartbeatTimeout --> pre-candidate")
+			f.timeout = getRandomTimeout(timeoutBase, priority)
+			f.heartbeatMonitor.Start(f.timeout, f.heartbeatTimeout)
+			go f.requestPreVote(f.highestReceivedTerm + 1)
+			return preCandidate
+		},
+		preVoteGranted: func() state {
+			log.Println("leader election - pre-candidate: preVoteGranted --> candidate")
+			f.currentTerm = f.highestReceivedTerm + 1
+			f.heartbeatMonitor.Reset(timeoutBase)
+			f.heartbeatSender.Start(periode, f.sendHeartbeat)
+			return candidate
+		},
+		preVoteRejected: func() state {
+			log.Println("leader election - pre-candidate: preVoteRejected --> follower")
+			f.preVoteWindow.Stop()
+			f.heartbeatMonitor.Reset(f.timeout)
+			return follower
+		},
+	}
+
 	f.transitions[follower] = map[event]transition{
 		ownHeartbeatReceived: func() state {
 			log.Println("leader election - follower: ownHeartbeatReceived --> follower")
@@ -108,8 +178,18 @@ func newFsm(id string, api leaderElectionAPI, periode time.Duration, timeoutBase
 			return follower
 		},
 		heartbeatTimeout: func() state {
-			log.Println("leader election - follower: heartbeatTimeout --> candidate")
+			// the term is only incremented if a quorum of the cluster is
+			// reachable, so a partitioned node does not disrupt the leader
+			// when it rejoins
+			log.Println("leader election - follower: heartbeatTimeout --> pre-candidate")
+			f.heartbeatMonitor.Start(f.timeout, f.heartbeatTimeout)
+			go f.requestPreVote(f.highestReceivedTerm + 1)
+			return preCandidate
+		},
+		handoverReceived: func() state {
+			log.Println("leader election - follower: handoverReceived --> candidate")
 			f.currentTerm = f.highestReceivedTerm + 1
+			f.heartbeatMonitor.Reset(timeoutBase)
 			f.heartbeatSender.Start(periode, f.sendHeartbeat)
 			return candidate
 		},
@@ -119,25 +199,259 @@ func newFsm(id string, api leaderElectionAPI, periode time.Duration, timeoutBase
 }
 
 func (f *fsm) start() {
+	if f.passive {
+		return
+	}
 	f.heartbeatMonitor.Start(f.timeout, f.heartbeatTimeout)
 }
 
 func (f *fsm) handleHeartbeat(leaderHeartbeat leaderHeartbeat) {
+	if f.passive {
+		f.observeHeartbeat(leaderHeartbeat)
+		return
+	}
+
+	// the event is applied after releasing the lock, as applyEvent takes it
+	f.mu.Lock()
+	var event event
 	if leaderHeartbeat.Term == f.highestReceivedTerm && leaderHeartbeat.LeaderId == f.id {
-		f.applyEvent(ownHeartbeatReceived)
+		event = ownHeartbeatReceived
 	} else if leaderHeartbeat.Term == f.highestReceivedTerm && leaderHeartbeat.LeaderId == f.currentLeader {
 		// ignore heartbeats in the same term but from different candidates
-		f.applyEvent(differentHeartbeatReceived)
+		event = differentHeartbeatReceived
 	} else if leaderHeartbeat.Term > f.highestReceivedTerm {
 		f.highestReceivedTerm = leaderHeartbeat.Term
 		f.currentLeader = leaderHeartbeat.LeaderId
 		if leaderHeartbeat.LeaderId == f.id {
-			f.applyEvent(ownHeartbeatReceived)
+			event = ownHeartbeatReceived
 		} else {
-			f.applyEvent(differentHeartbeatReceived)
+			event = differentHeartbeatReceived
 		}
 	} else {
 		log.Printf("leader election - ignoring heartbeat! Highest reveid term: %d - current leader: %s", f.highestReceivedTerm, f.currentLeader)
+		f.mu.Unlock()
+		return
+	}
+	f.mu.Unlock()
+
+	f.applyEvent(event)
+	f.heartbeatReceived()
+}
+
+// observeHeartbeat follows the elected leader without taking part in the
+// election. Leader changes are reported as lost leadership to the observers.
+func (f *fsm) observeHeartbeat(leaderHeartbeat leaderHeartbeat) {
+	f.mu.Lock()
+
+	if leaderHeartbeat.Term < f.highestReceivedTerm || (leaderHeartbeat.Term == f.highestReceivedTerm && leaderHeartbeat.LeaderId != f.currentLeader) {
+		log.Printf("leader election - ignoring heartbeat! Highest reveid term: %d - current leader: %s", f.highestReceivedTerm, f.currentLeader)
+		f.mu.Unlock()
+		return
+	}
+
+	if leaderHeartbeat.Term > f.highestReceivedTerm {
+		log.Printf("leader election - observed new leader %s in term %d", leaderHeartbeat.LeaderId, leaderHeartbeat.Term)
+		f.highestReceivedTerm = leaderHeartbeat.Term
+		f.currentLeader = leaderHeartbeat.LeaderId
+		f.updateLeadership(false)
+	}
+
+	f.mu.Unlock()
+	f.heartbeatReceived()
+}
+
+// handleHandover starts the takeover if the current leader hands over its
+// leadership to this node.
+func (f *fsm) handleHandover(handover leaderHandover) {
+	if handover.SuccessorId != f.id {
+		return
+	}
+
+	term, currentLeader := f.termAndLeader()
+	if handover.Term != term || handover.LeaderId != currentLeader {
+		log.Printf("leader election - ignoring outdated handover from %s in term %d", handover.LeaderId, handover.Term)
+		return
+	}
+
+	f.applyEvent(handoverReceived)
+}
+
+// handlePreVote handles a committed pre-vote. Voters which still receive
+// heartbeats from a live leader reject the pre-vote of other nodes. The
+// pre-vote of this node is granted if no rejection arrives within one
+// heartbeat periode.
+func (f *fsm) handlePreVote(preVote leaderPreVote) {
+	if preVote.CandidateId != f.id {
+		if !f.passive && f.hasLiveLeader(preVote.CandidateId) {
+			log.Printf("leader election - rejecting pre-vote of %s for term %d, the leader is alive", preVote.CandidateId, preVote.Term)
+			go f.api.sendPreVoteRejection(preVote.Term, preVote.CandidateId, f.id)
+		}
+		return
+	}
+
+	if term, _ := f.termAndLeader(); preVote.Term != term+1 {
+		log.Printf("leader election - ignoring outdated pre-vote for term %d", preVote.Term)
+		f.applyEvent(preVoteRejected)
+		return
+	}
+
+	f.preVoteWindow.Stop()
+	f.preVoteWindow.Start(f.periode, func() {
+		if term, _ := f.termAndLeader(); preVote.Term == term+1 {
+			f.applyEvent(preVoteGranted)
+		}
+	})
+}
+
+// handlePreVoteRejection rejects the pending pre-vote of this node.
+func (f *fsm) handlePreVoteRejection(rejection leaderPreVoteRejection) {
+	if term, _ := f.termAndLeader(); rejection.CandidateId != f.id || rejection.Term != term+1 {
+		return
+	}
+
+	log.Printf("leader election - pre-vote for term %d rejected by %s", rejection.Term, rejection.VoterId)
+	f.applyEvent(preVoteRejected)
+}
+
+// termAndLeader returns the highest received term and its leader.
+func (f *fsm) termAndLeader() (uint64, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.highestReceivedTerm, f.currentLeader
+}
+
+// hasLiveLeader reports whether a heartbeat of a leader other than candidateId
+// was received within the heartbeat timeout.
+func (f *fsm) hasLiveLeader(candidateId string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.currentLeader != "" && f.currentLeader != candidateId && time.Since(f.lastHeartbeat) < f.timeoutBase
+}
+
+// requestPreVote proposes a pre-vote for the given term. The pre-vote is
+// rejected if it cannot be committed, i.e. no quorum is reachable.
+func (f *fsm) requestPreVote(term uint64) {
+	if err := f.api.sendPreVote(term, f.id); err != nil {
+		log.Printf("leader election - pre-vote for term %d not committed: %s", term, err)
+		f.applyEvent(preVoteRejected)
+	}
+}
+
+// handleCandidate keeps track of the registered leader candidates. A leader
+// hands over to a candidate with a higher priority when it registers.
+func (f *fsm) handleCandidate(id string, priority int, registered bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !registered {
+		delete(f.candidates, id)
+		delete(f.candidateSeen, id)
+		return
+	}
+
+	known := f.candidateAlive(id, time.Now()) && f.candidates[id] == priority
+	f.candidates[id] = priority
+	f.candidateSeen[id] = time.Now()
+
+	if !known && f.currentState == leader && id != f.id && priority > f.priority {
+		log.Printf("leader election - candidate %s has a higher priority (%d > %d), handing over leadership", id, priority, f.priority)
+		go f.api.sendHandover(context.Background(), f.currentTerm, f.id, id)
+	}
+}
+
+// transferLeadership proposes a handover to the preferred candidate and waits
+// until the successor took over. The leader keeps heartbeating meanwhile, so
+// its current round is finished. Does nothing if this node is not leader.
+func (f *fsm) transferLeadership(ctx context.Context) error {
+	f.mu.Lock()
+	if f.currentState != leader {
+		f.mu.Unlock()
+		return nil
+	}
+
+	successor, ok := f.preferredCandidate(math.MinInt)
+	if !ok {
+		f.mu.Unlock()
+		return errNoSuccessor
+	}
+
+	term := f.currentTerm
+	stepDown := make(chan bool, 1)
+	f.nextObserverId++
+	observerId := f.nextObserverId
+	f.observers[observerId] = stepDown
+	f.mu.Unlock()
+
+	defer f.removeStateChangeObserver(observerId)
+
+	log.Printf("leader election - stepping down in favour of %s", successor)
+	f.api.sendHandover(ctx, term, f.id, successor)
+
+	for {
+		select {
+		case isLeader := <-stepDown:
+			if !isLeader {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// preferredCandidate returns the live candidate with the highest priority of
+// at least minimumPriority, ties are broken by the candidate id. Has to be
+// called with the lock held.
+func (f *fsm) preferredCandidate(minimumPriority int) (string, bool) {
+	preferred := ""
+	preferredPriority := minimumPriority
+	now := time.Now()
+
+	for id, priority := range f.candidates {
+		if id == f.id || priority < minimumPriority || !f.candidateAlive(id, now) {
+			continue
+		}
+
+		if preferred == "" || priority > preferredPriority || (priority == preferredPriority && id < preferred) {
+			preferred = id
+			preferredPriority = priority
+		}
+	}
+
+	return preferred, preferred != ""
+}
+
+// candidateAlive reports whether the candidate refreshed its entry within
+// three heartbeat timeouts. Has to be called with the lock held.
+func (f *fsm) candidateAlive(id string, now time.Time) bool {
+	seen, ok := f.candidateSeen[id]
+	return ok && now.Sub(seen) < 3*f.timeoutBase
+}
+
+// expireCandidates removes the entries of candidates which stopped refreshing
+// them, e.g. after a crash. Only the leader removes them.
+func (f *fsm) expireCandidates() {
+	f.mu.Lock()
+	if f.currentState != leader {
+		f.mu.Unlock()
+		return
+	}
+
+	var expired []string
+	now := time.Now()
+	for id := range f.candidates {
+		if id != f.id && !f.candidateAlive(id, now) {
+			expired = append(expired, id)
+			delete(f.candidates, id)
+			delete(f.candidateSeen, id)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, id := range expired {
+		log.Printf("leader election - candidate %s expired", id)
+		go f.api.removeCandidate(id)
 	}
 }
 
@@ -166,6 +480,55 @@ func (f *fsm) removeStateChangeObserver(chanId uint64) {
 	delete(f.observers, chanId)
 }
 
+// heartbeatReceived records the time of the last accepted heartbeat and
+// publishes the leader info.
+func (f *fsm) heartbeatReceived() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastHeartbeat = time.Now()
+	info := f.leaderInfoLocked()
+
+	for _, observer := range f.infoObservers {
+		// only the latest info is of interest, replace an unread one
+		select {
+		case observer <- info:
+		default:
+			select {
+			case <-observer:
+			default:
+			}
+			observer <- info
+		}
+	}
+}
+
+func (f *fsm) leaderInfo() LeaderInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.leaderInfoLocked()
+}
+
+func (f *fsm) leaderInfoLocked() LeaderInfo {
+	return LeaderInfo{LeaderId: f.currentLeader, Term: f.highestReceivedTerm, LastHeartbeat: f.lastHeartbeat}
+}
+
+func (f *fsm) addLeaderInfoObserver(ch chan LeaderInfo) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextObserverId++
+	f.infoObservers[f.nextObserverId] = ch
+
+	return f.nextObserverId
+}
+
+func (f *fsm) removeLeaderInfoObserver(chanId uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.infoObservers, chanId)
+}
+
 func (f *fsm) updateLeadership(value bool) {
 	for _, observer := range f.observers {
 		observer <- value
@@ -173,6 +536,7 @@ func (f *fsm) updateLeadership(value bool) {
 }
 
 func (f *fsm) close() {
+	f.preVoteWindow.Stop()
 	f.heartbeatMonitor.Stop()
 	f.heartbeatSender.Stop()
 }
@@ -184,13 +548,26 @@ func (f *fsm) heartbeatTimeout() {
 
 func (f *fsm) sendHeartbeat() {
 	f.api.sendHeartbeat(f.id, f.currentTerm)
+	// the first heartbeat is sent by a transition with the lock held
+	go f.expireCandidates()
 }
 
-func getRandomTimeout(heartbeatTimeoutBase time.Duration) time.Duration {
-	timeout := heartbeatTimeoutBase.Milliseconds() + int64(rand.Float64()*float64(heartbeatTimeoutBase.Milliseconds()))
+// getRandomTimeout returns a timeout between heartbeatTimeoutBase and
+// 2*heartbeatTimeoutBase. The higher the priority, the smaller the random part,
+// so nodes with a higher priority tend to become candidates first.
+func getRandomTimeout(heartbeatTimeoutBase time.Duration, priority int) time.Duration {
+	if priority < 0 {
+		priority = 0
+	}
+
+	timeout := heartbeatTimeoutBase.Milliseconds() + int64(rand.Float64()*float64(heartbeatTimeoutBase.Milliseconds())/float64(priority+1))
 	return time.Duration(timeout) * time.Millisecond
 }
 
 type leaderElectionAPI interface {
 	sendHeartbeat(id string, term uint64)
+	sendHandover(ctx context.Context, term uint64, leaderId string, successorId string)
+	sendPreVote(term uint64, candidateId string) error
+	sendPreVoteRejection(term uint64, candidateId string, voterId string)
+	removeCandidate(id string)
 }
@@ -0,0 +1,471 @@
+package dda
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBus delivers heartbeats and handovers to all fsms in order and
+// asynchronously, like the replicated raft log does.
+type testBus struct {
+	mu     sync.Mutex
+	fsms   []*fsm
+	inputs chan func(f *fsm)
+}
+
+func newTestBus() *testBus {
+	b := &testBus{inputs: make(chan func(f *fsm), 100)}
+
+	go func() {
+		for apply := range b.inputs {
+			b.mu.Lock()
+			fsms := append([]*fsm{}, b.fsms...)
+			b.mu.Unlock()
+
+			for _, f := range fsms {
+				apply(f)
+			}
+		}
+	}()
+
+	return b
+}
+
+func (b *testBus) add(f *fsm) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fsms = append(b.fsms, f)
+}
+
+func (b *testBus) deliver(apply func(f *fsm)) {
+	b.inputs <- apply
+}
+
+type testAPI struct {
+	bus *testBus
+
+	// a partitioned node neither gets its heartbeats nor its pre-votes
+	// committed
+	partitioned atomic.Bool
+
+	// ids of nodes which do not receive heartbeats
+	deaf sync.Map
+
+	// handovers are not committed without quorum, their proposal blocks
+	// until ctx is done
+	noQuorumForHandover atomic.Bool
+}
+
+func (a *testAPI) sendHeartbeat(id string, term uint64) {
+	if a.partitioned.Load() {
+		return
+	}
+	a.bus.deliver(func(f *fsm) {
+		if _, deaf := a.deaf.Load(f.id); !deaf {
+			f.handleHeartbeat(leaderHeartbeat{Term: term, LeaderId: id})
+		}
+	})
+}
+
+func (a *testAPI) sendHandover(ctx context.Context, term uint64, leaderId string, successorId string) {
+	if a.noQuorumForHandover.Load() {
+		<-ctx.Done()
+		return
+	}
+	a.bus.deliver(func(f *fsm) {
+		f.handleHandover(leaderHandover{Term: term, LeaderId: leaderId, SuccessorId: successorId})
+	})
+}
+
+func (a *testAPI) sendPreVote(term uint64, candidateId string) error {
+	if a.partitioned.Load() {
+		return errors.New("partitioned")
+	}
+	a.bus.deliver(func(f *fsm) { f.handlePreVote(leaderPreVote{Term: term, CandidateId: candidateId}) })
+	return nil
+}
+
+func (a *testAPI) sendPreVoteRejection(term uint64, candidateId string, voterId string) {
+	a.bus.deliver(func(f *fsm) {
+		f.handlePreVoteRejection(leaderPreVoteRejection{Term: term, CandidateId: candidateId, VoterId: voterId})
+	})
+}
+
+func (a *testAPI) removeCandidate(id string) {
+	a.bus.deliver(func(f *fsm) { f.handleCandidate(id, 0, false) })
+}
+
+func currentState(f *fsm) state {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.currentState
+}
+
+func TestRandomTimeoutPriority(t *testing.T) {
+	base := 100 * time.Millisecond
+
+	for i := 0; i < 100; i++ {
+		if timeout := getRandomTimeout(base, 0); timeout < base || timeout > 2*base {
+			t.Fatalf("Timeout out of range: %s", timeout)
+		}
+
+		if timeout := getRandomTimeout(base, 3); timeout < base || timeout > base+base/4 {
+			t.Fatalf("Timeout for priority 3 out of range: %s", timeout)
+		}
+	}
+}
+
+func TestHandoverToHigherPriorityCandidate(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	b := newFsm("b", 5, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(b)
+	b.start()
+	defer b.close()
+
+	time.Sleep(30 * time.Millisecond)
+	a.handleCandidate("b", 5, true)
+	b.handleCandidate("b", 5, true)
+
+	time.Sleep(100 * time.Millisecond)
+	if currentState(b) != leader {
+		t.Errorf("b did not take over leadership")
+	}
+	if currentState(a) != follower {
+		t.Errorf("a did not step down")
+	}
+}
+
+func TestTransferLeadership(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	b := newFsm("b", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(b)
+	b.start()
+	defer b.close()
+
+	time.Sleep(30 * time.Millisecond)
+	a.handleCandidate("b", 0, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := a.transferLeadership(ctx); err != nil {
+		t.Fatalf("Could not transfer leadership: %s", err)
+	}
+
+	if currentState(a) != follower {
+		t.Errorf("a did not step down")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if currentState(b) != leader {
+		t.Errorf("b did not take over leadership")
+	}
+}
+
+func TestTransferLeadershipWithoutCandidate(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if err := a.transferLeadership(context.Background()); err != errNoSuccessor {
+		t.Errorf("Expected errNoSuccessor, got %v", err)
+	}
+}
+
+func TestTransferLeadershipWithoutQuorum(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	a.handleCandidate("b", 0, true)
+	api.noQuorumForHandover.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- a.transferLeadership(ctx) }()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected a deadline error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Transfer blocked on the handover proposal")
+	}
+}
+
+func TestCrashedCandidateExpires(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	// b registered but crashed before refreshing its entry
+	a.handleCandidate("b", 0, true)
+	time.Sleep(200 * time.Millisecond)
+
+	a.mu.Lock()
+	_, registered := a.candidates["b"]
+	a.mu.Unlock()
+	if registered {
+		t.Errorf("Crashed candidate not removed")
+	}
+
+	if err := a.transferLeadership(context.Background()); err != errNoSuccessor {
+		t.Errorf("Leadership transferred to a crashed candidate: %v", err)
+	}
+	if currentState(a) != leader {
+		t.Errorf("a stepped down without successor")
+	}
+}
+
+func TestRefreshedCandidateStays(t *testing.T) {
+	a := newFsm("a", 0, &testAPI{bus: newTestBus()}, 20*time.Millisecond, 50*time.Millisecond)
+
+	a.handleCandidate("b", 0, true)
+	time.Sleep(100 * time.Millisecond)
+	a.handleCandidate("b", 0, true)
+	time.Sleep(100 * time.Millisecond)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if successor, ok := a.preferredCandidate(math.MinInt); !ok || successor != "b" {
+		t.Errorf("Refreshed candidate not preferred: %s", successor)
+	}
+}
+
+func currentTerm(f *fsm) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.currentTerm
+}
+
+func TestPartitionedFollowerKeepsTerm(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+	api.partitioned.Store(true)
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(400 * time.Millisecond)
+
+	if s := currentState(a); s == leader || s == candidate {
+		t.Errorf("Partitioned node became leader or candidate: %d", s)
+	}
+	if term := currentTerm(a); term != 0 {
+		t.Errorf("Partitioned node incremented its term: %d", term)
+	}
+
+	api.partitioned.Store(false)
+	time.Sleep(300 * time.Millisecond)
+
+	if currentState(a) != leader || currentTerm(a) != 1 {
+		t.Errorf("Node did not become leader in term 1 after the partition healed")
+	}
+}
+
+func TestLeaderStepsDownWithoutQuorum(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	api.partitioned.Store(true)
+	time.Sleep(100 * time.Millisecond)
+
+	if currentState(a) == leader {
+		t.Errorf("Leader did not step down without committed heartbeats")
+	}
+}
+
+func TestLeaderInfo(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	b := newFsm("b", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	infoChannel := make(chan LeaderInfo, 1)
+	b.addLeaderInfoObserver(infoChannel)
+	bus.add(b)
+	b.start()
+	defer b.close()
+
+	select {
+	case info := <-infoChannel:
+		if info.LeaderId != "a" || info.Term != currentTerm(a) || info.LastHeartbeat.IsZero() {
+			t.Errorf("Wrong leader info: %+v", info)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No leader info published")
+	}
+
+	if info := b.leaderInfo(); info.LeaderId != "a" {
+		t.Errorf("Wrong leader: %+v", info)
+	}
+}
+
+func TestPassiveObserver(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	observer := newFsm("observer", 0, api, 50*time.Millisecond, 50*time.Millisecond)
+	observer.passive = true
+	leaderChannel := make(chan bool, 10)
+	observer.addStateChangeObserver(leaderChannel)
+	bus.add(observer)
+	observer.start()
+	defer observer.close()
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	select {
+	case isLeader := <-leaderChannel:
+		if isLeader {
+			t.Errorf("Observer reported leadership")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Leader change not reported")
+	}
+
+	if info := observer.leaderInfo(); info.LeaderId != "a" {
+		t.Errorf("Wrong leader observed: %+v", info)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(observer) != follower || len(leaderChannel) != 0 {
+		t.Errorf("Observer took part in the leader election")
+	}
+}
+
+func TestPreVoteRejectedWhileLeaderAlive(t *testing.T) {
+	bus := newTestBus()
+	api := &testAPI{bus: bus}
+
+	a := newFsm("a", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(a)
+	a.start()
+	defer a.close()
+
+	time.Sleep(200 * time.Millisecond)
+	if currentState(a) != leader {
+		t.Fatalf("a did not become leader")
+	}
+
+	// b misses the heartbeats of the live leader and requests pre-votes
+	api.deaf.Store("b", true)
+	b := newFsm("b", 0, api, 20*time.Millisecond, 50*time.Millisecond)
+	bus.add(b)
+	b.start()
+	defer b.close()
+
+	time.Sleep(400 * time.Millisecond)
+
+	if s := currentState(b); s == leader || s == candidate {
+		t.Errorf("b became leader or candidate while the leader is alive: %d", s)
+	}
+	if currentState(a) != leader || currentTerm(a) != 1 {
+		t.Errorf("Live leader was disrupted")
+	}
+}
+
+func TestConcurrentHeartbeatAndPreVote(t *testing.T) {
+	a := newFsm("a", 0, &testAPI{bus: newTestBus()}, time.Millisecond, 50*time.Millisecond)
+	defer a.close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		for term := uint64(1); term <= 200; term++ {
+			a.handleHeartbeat(leaderHeartbeat{Term: term, LeaderId: "b"})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+		for term := uint64(1); term <= 200; term++ {
+			a.handlePreVote(leaderPreVote{Term: term, CandidateId: "a"})
+			a.handlePreVoteRejection(leaderPreVoteRejection{Term: term, CandidateId: "a", VoterId: "c"})
+			a.handleHandover(leaderHandover{Term: term, LeaderId: "b", SuccessorId: "a"})
+		}
+	}()
+
+	wg.Wait()
+	// let pending pre-vote windows expire
+	time.Sleep(10 * time.Millisecond)
+}
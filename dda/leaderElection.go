@@ -4,19 +4,61 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/coatyio/dda/services/state/api"
 )
 
 const LEADER_KEY = "leader"
+const LEADER_HANDOVER_KEY = "leader_handover"
+const LEADER_CANDIDATE_PREFIX = "leadercandidate_"
+const LEADER_PREVOTE_KEY = "leader_prevote"
+const LEADER_PREVOTE_REJECTION_KEY = "leader_prevote_rejection"
 
 type leaderHeartbeat struct {
 	Term     uint64
 	LeaderId string
 }
 
+// leaderHandover is proposed by the leader to step down in favour of the
+// successor, which starts heartbeating immediately.
+type leaderHandover struct {
+	Term        uint64
+	LeaderId    string
+	SuccessorId string
+}
+
+// leaderPreVote is proposed by a follower before it becomes candidate. It is
+// only committed if a quorum of the cluster is reachable.
+type leaderPreVote struct {
+	Term        uint64
+	CandidateId string
+}
+
+// leaderPreVoteRejection is proposed by a voter which still receives
+// heartbeats from a live leader when the pre-vote of a candidate is committed.
+type leaderPreVoteRejection struct {
+	Term        uint64
+	CandidateId string
+	VoterId     string
+}
+
+type leaderCandidate struct {
+	Priority int
+}
+
+// LeaderInfo describes the current leader as seen by this node.
+type LeaderInfo struct {
+	LeaderId      string
+	Term          uint64
+	LastHeartbeat time.Time
+}
+
 type LeaderElection struct {
+	id           string
+	priority     int
+	timeoutBase  time.Duration
 	ddaConnector *Connector
 	fsm          *fsm
 
@@ -24,14 +66,25 @@ type LeaderElection struct {
 	cancel context.CancelFunc
 }
 
-func New(id string, heartbeatPeriode time.Duration, heartbeatTimeoutBase time.Duration) *LeaderElection {
+func New(id string, priority int, heartbeatPeriode time.Duration, heartbeatTimeoutBase time.Duration) *LeaderElection {
 	ctx, cancel := context.WithCancel(context.Background())
 	le := &LeaderElection{
-		ctx:    ctx,
-		cancel: cancel,
+		id:          id,
+		priority:    priority,
+		timeoutBase: heartbeatTimeoutBase,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 
-	le.fsm = newFsm(id, le, heartbeatPeriode, heartbeatTimeoutBase)
+	le.fsm = newFsm(id, priority, le, heartbeatPeriode, heartbeatTimeoutBase)
+	return le
+}
+
+// NewObserver creates a leader election which only follows the elected leader
+// through the replicated leader key. It never becomes leader.
+func NewObserver(id string, heartbeatTimeoutBase time.Duration) *LeaderElection {
+	le := New(id, 0, heartbeatTimeoutBase, heartbeatTimeoutBase)
+	le.fsm.passive = true
 	return le
 }
 
@@ -48,7 +101,10 @@ func (le *LeaderElection) Open(ddaConnector *Connector) error {
 		}
 	}()
 
-	le.fsm.start()
+	if !le.fsm.passive {
+		le.fsm.start()
+		go le.registerCandidate()
+	}
 	return nil
 }
 
@@ -65,16 +121,62 @@ func (le *LeaderElection) LeaderCh(ctx context.Context) <-chan bool {
 	return leaderChannel
 }
 
+// LeaderInfo returns the current leader, its term and the time of the last
+// heartbeat received from it.
+func (le *LeaderElection) LeaderInfo() LeaderInfo {
+	return le.fsm.leaderInfo()
+}
+
+// LeaderInfoCh publishes the leader info on every heartbeat until ctx is done.
+// Only the latest info is kept if the channel is not read in time.
+func (le *LeaderElection) LeaderInfoCh(ctx context.Context) <-chan LeaderInfo {
+	leaderInfoChannel := make(chan LeaderInfo, 1)
+	id := le.fsm.addLeaderInfoObserver(leaderInfoChannel)
+
+	go func() {
+		<-ctx.Done()
+		le.fsm.removeLeaderInfoObserver(id)
+		close(leaderInfoChannel)
+	}()
+
+	return leaderInfoChannel
+}
+
+// TransferLeadership hands over the leadership to the preferred candidate and
+// returns when the successor sends heartbeats. It returns immediately if this
+// node is not leader.
+func (le *LeaderElection) TransferLeadership(ctx context.Context) error {
+	return le.fsm.transferLeadership(ctx)
+}
+
 func (le *LeaderElection) Close() {
+	ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+	if err := le.TransferLeadership(ctx); err != nil {
+		log.Printf("leader election - Could not transfer leadership: %s", err)
+	}
+	cancel()
+
 	le.fsm.close()
+	le.deregisterCandidate()
 	le.cancel()
 }
 
 func (le *LeaderElection) handleStateUpdate(change api.Input) {
-	if change.Key != LEADER_KEY {
-		return
+	switch {
+	case change.Key == LEADER_KEY:
+		le.handleHeartbeat(change)
+	case change.Key == LEADER_HANDOVER_KEY:
+		le.handleHandover(change)
+	case change.Key == LEADER_PREVOTE_KEY:
+		le.handlePreVote(change)
+	case change.Key == LEADER_PREVOTE_REJECTION_KEY:
+		le.handlePreVoteRejection(change)
+	case strings.HasPrefix(change.Key, LEADER_CANDIDATE_PREFIX):
+		le.handleCandidate(change)
 	}
+}
 
+func (le *LeaderElection) handleHeartbeat(change api.Input) {
 	if change.Op != api.InputOpSet {
 		return
 	}
@@ -106,7 +208,202 @@ func (le *LeaderElection) sendHeartbeat(id string, term uint64) {
 		Value: value,
 	}
 
-	if err := le.ddaConnector.ProposeInput(le.ctx, &input); err != nil {
+	// heartbeats which are not committed in time are dropped, the leader
+	// steps down if none of them gets committed
+	ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+	defer cancel()
+
+	if err := le.ddaConnector.ProposeInput(ctx, &input); err != nil {
 		log.Printf("leader election - Could not send heartbeat: %s", err)
 	}
 }
+
+func (le *LeaderElection) handleHandover(change api.Input) {
+	if change.Op != api.InputOpSet {
+		return
+	}
+
+	var handover leaderHandover
+	if err := json.Unmarshal(change.Value, &handover); err != nil {
+		log.Printf("leader election - error unmarshalling leader handover: %s", err)
+		return
+	}
+
+	le.fsm.handleHandover(handover)
+}
+
+// sendHandover proposes the handover within ctx, at most for the heartbeat
+// timeout, so a leader without quorum does not block.
+func (le *LeaderElection) sendHandover(ctx context.Context, term uint64, leaderId string, successorId string) {
+	log.Printf("leader election - handing over leadership to %s", successorId)
+
+	handover := leaderHandover{
+		Term:        term,
+		LeaderId:    leaderId,
+		SuccessorId: successorId,
+	}
+
+	value, _ := json.Marshal(handover)
+
+	input := api.Input{
+		Op:    api.InputOpSet,
+		Key:   LEADER_HANDOVER_KEY,
+		Value: value,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, le.timeoutBase)
+	defer cancel()
+
+	if err := le.ddaConnector.ProposeInput(ctx, &input); err != nil {
+		log.Printf("leader election - Could not send handover: %s", err)
+	}
+}
+
+func (le *LeaderElection) handlePreVote(change api.Input) {
+	if change.Op != api.InputOpSet {
+		return
+	}
+
+	var preVote leaderPreVote
+	if err := json.Unmarshal(change.Value, &preVote); err != nil {
+		log.Printf("leader election - error unmarshalling leader pre-vote: %s", err)
+		return
+	}
+
+	le.fsm.handlePreVote(preVote)
+}
+
+func (le *LeaderElection) sendPreVote(term uint64, candidateId string) error {
+	log.Printf("leader election - sending pre-vote for term %d", term)
+
+	preVote := leaderPreVote{
+		Term:        term,
+		CandidateId: candidateId,
+	}
+
+	value, _ := json.Marshal(preVote)
+
+	input := api.Input{
+		Op:    api.InputOpSet,
+		Key:   LEADER_PREVOTE_KEY,
+		Value: value,
+	}
+
+	ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+	defer cancel()
+
+	return le.ddaConnector.ProposeInput(ctx, &input)
+}
+
+func (le *LeaderElection) handlePreVoteRejection(change api.Input) {
+	if change.Op != api.InputOpSet {
+		return
+	}
+
+	var rejection leaderPreVoteRejection
+	if err := json.Unmarshal(change.Value, &rejection); err != nil {
+		log.Printf("leader election - error unmarshalling leader pre-vote rejection: %s", err)
+		return
+	}
+
+	le.fsm.handlePreVoteRejection(rejection)
+}
+
+func (le *LeaderElection) sendPreVoteRejection(term uint64, candidateId string, voterId string) {
+	rejection := leaderPreVoteRejection{
+		Term:        term,
+		CandidateId: candidateId,
+		VoterId:     voterId,
+	}
+
+	value, _ := json.Marshal(rejection)
+
+	input := api.Input{
+		Op:    api.InputOpSet,
+		Key:   LEADER_PREVOTE_REJECTION_KEY,
+		Value: value,
+	}
+
+	ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+	defer cancel()
+
+	if err := le.ddaConnector.ProposeInput(ctx, &input); err != nil {
+		log.Printf("leader election - Could not reject pre-vote: %s", err)
+	}
+}
+
+func (le *LeaderElection) handleCandidate(change api.Input) {
+	id := strings.TrimPrefix(change.Key, LEADER_CANDIDATE_PREFIX)
+
+	if change.Op == api.InputOpDelete {
+		le.fsm.handleCandidate(id, 0, false)
+		return
+	}
+
+	var candidate leaderCandidate
+	if err := json.Unmarshal(change.Value, &candidate); err != nil {
+		log.Printf("leader election - error unmarshalling leader candidate: %s", err)
+		return
+	}
+
+	le.fsm.handleCandidate(id, candidate.Priority, true)
+}
+
+// registerCandidate proposes the candidate entry every heartbeat timeout until
+// the leader election is closed, so the leader removes the entry of a crashed
+// candidate. Every proposal is bounded by the heartbeat timeout.
+func (le *LeaderElection) registerCandidate() {
+	value, _ := json.Marshal(leaderCandidate{Priority: le.priority})
+
+	input := api.Input{
+		Op:    api.InputOpSet,
+		Key:   LEADER_CANDIDATE_PREFIX + le.id,
+		Value: value,
+	}
+
+	for {
+		ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+		if err := le.ddaConnector.ProposeInput(ctx, &input); err != nil {
+			log.Printf("leader election - Could not register as candidate: %s", err)
+		}
+		cancel()
+
+		select {
+		case <-le.ctx.Done():
+			return
+		case <-time.After(le.timeoutBase):
+		}
+	}
+}
+
+func (le *LeaderElection) deregisterCandidate() {
+	if le.ddaConnector == nil || le.fsm.passive {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(le.ctx, time.Second)
+	defer cancel()
+
+	if err := le.proposeCandidateRemoval(ctx, le.id); err != nil {
+		log.Printf("leader election - Could not deregister as candidate: %s", err)
+	}
+}
+
+// removeCandidate deletes the entry of an expired candidate.
+func (le *LeaderElection) removeCandidate(id string) {
+	ctx, cancel := context.WithTimeout(le.ctx, le.timeoutBase)
+	defer cancel()
+
+	if err := le.proposeCandidateRemoval(ctx, id); err != nil {
+		log.Printf("leader election - Could not remove candidate %s: %s", id, err)
+	}
+}
+
+func (le *LeaderElection) proposeCandidateRemoval(ctx context.Context, id string) error {
+	input := api.Input{
+		Op:  api.InputOpDelete,
+		Key: LEADER_CANDIDATE_PREFIX + id,
+	}
+
+	return le.ddaConnector.ProposeInput(ctx, &input)
+}
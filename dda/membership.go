@@ -0,0 +1,325 @@
+package dda
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/coatyio/dda/config"
+	"github.com/coatyio/dda/dda"
+	"github.com/coatyio/dda/services/com/api"
+	"github.com/coatyio/dda/services/state/raft"
+	"github.com/google/uuid"
+	hraft "github.com/hashicorp/raft"
+)
+
+const MEMBERSHIP_ACTION = "com.siemens.openswarm.membership"
+
+const (
+	MembershipAddVoter    = "add-voter"
+	MembershipAddNonvoter = "add-nonvoter"
+	MembershipRemove      = "remove"
+	MembershipList        = "list"
+)
+
+const membershipTimeout = 10 * time.Second
+
+var errStateDisabled = errors.New("state synchronization is disabled, enable leader election or observe it")
+
+var (
+	errMembershipDisabled         = errors.New("membership requests are disabled, no membership secret configured on the raft leader")
+	errMembershipNotAuthenticated = errors.New("membership request not authenticated, wrong membership secret")
+)
+
+// Member is a node of the raft cluster of an energy community.
+type Member struct {
+	Id     string
+	Voter  bool
+	Leader bool
+}
+
+type membershipRequest struct {
+	Op     string
+	NodeId string
+	// Secret is the membership secret of the requesting node, it is only
+	// sent with forwarded requests
+	Secret string
+}
+
+type membershipResponse struct {
+	Members []Member
+	Error   string
+}
+
+// AddVoter adds the node to the raft cluster as a voter or promotes it if it
+// is a non-voter.
+func (c *Connector) AddVoter(ctx context.Context, nodeId string) error {
+	_, err := c.requestMembership(ctx, membershipRequest{Op: MembershipAddVoter, NodeId: nodeId})
+	return err
+}
+
+// AddNonvoter adds the node to the raft cluster as a non-voter, which receives
+// the replicated state but does not count for the quorum. A voter is demoted.
+func (c *Connector) AddNonvoter(ctx context.Context, nodeId string) error {
+	_, err := c.requestMembership(ctx, membershipRequest{Op: MembershipAddNonvoter, NodeId: nodeId})
+	return err
+}
+
+// RemoveMember removes the node from the raft cluster, e.g. a broken node
+// which will not come back.
+func (c *Connector) RemoveMember(ctx context.Context, nodeId string) error {
+	_, err := c.requestMembership(ctx, membershipRequest{Op: MembershipRemove, NodeId: nodeId})
+	return err
+}
+
+// Members lists the nodes of the raft cluster.
+func (c *Connector) Members(ctx context.Context) ([]Member, error) {
+	return c.requestMembership(ctx, membershipRequest{Op: MembershipList})
+}
+
+// requestMembership executes the request on the raft leader. Nodes which are
+// not the raft leader, or not part of the raft cluster at all, forward it with
+// a DDA action.
+func (c *Connector) requestMembership(ctx context.Context, request membershipRequest) ([]Member, error) {
+	if c.state != nil && c.state.Node() != nil && c.state.Node().State() == hraft.Leader {
+		return c.executeMembership(request)
+	}
+
+	return c.forwardMembership(ctx, request)
+}
+
+// joinAsNonvoter asks the raft leader to add this node as non-voter, an
+// existing voter is demoted.
+func (c *Connector) joinAsNonvoter(ctx context.Context) error {
+	_, err := c.forwardMembership(ctx, membershipRequest{Op: MembershipAddNonvoter, NodeId: c.cfg.Id})
+	return err
+}
+
+func (c *Connector) forwardMembership(ctx context.Context, request membershipRequest) ([]Member, error) {
+	request.Secret = c.cfg.Auth.MembershipSecret
+	data, _ := json.Marshal(request)
+
+	actionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results, err := c.Dda.PublishAction(actionCtx, api.Action{Type: MEMBERSHIP_ACTION, Id: uuid.NewString(), Source: c.cfg.Id, Params: data})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case result, ok := <-results:
+		if !ok {
+			return nil, fmt.Errorf("no response to membership request %s", request.Op)
+		}
+
+		var response membershipResponse
+		if err := json.Unmarshal(result.Data, &response); err != nil {
+			return nil, err
+		}
+		if response.Error != "" {
+			return nil, errors.New(response.Error)
+		}
+		return response.Members, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no raft leader answered membership request %s: %w", request.Op, ctx.Err())
+	}
+}
+
+// serveMembershipRequests answers forwarded membership requests while this
+// node is the raft leader. Only requests with the membership secret of the
+// leader are executed, anyone reaching the broker could change the cluster
+// otherwise.
+func (c *Connector) serveMembershipRequests() error {
+	requests, err := c.Dda.SubscribeAction(c.ctx, api.SubscriptionFilter{Type: MEMBERSHIP_ACTION})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for action := range requests {
+			if c.state.Node() == nil || c.state.Node().State() != hraft.Leader {
+				continue
+			}
+
+			var request membershipRequest
+			if err := json.Unmarshal(action.Params, &request); err != nil {
+				log.Printf("DdaClient: could not unmarshal membership request: %s", err)
+				continue
+			}
+
+			var response membershipResponse
+			members, err := c.members()
+			if err != nil {
+				response.Error = err.Error()
+			} else if err := authenticateMembership(request, action.Source, c.cfg.Auth.MembershipSecret, members); err != nil {
+				log.Printf("DdaClient: rejected membership request %s %s from %s: %s", request.Op, request.NodeId, action.Source, err)
+				response.Error = err.Error()
+			} else if members, err := c.executeMembership(request); err != nil {
+				response.Error = err.Error()
+			} else {
+				response.Members = members
+			}
+
+			data, _ := json.Marshal(response)
+			if err := action.Callback(api.ActionResult{Context: c.cfg.Id, Data: data}); err != nil {
+				log.Printf("DdaClient: could not answer membership request: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// authenticateMembership accepts requests with the membership secret of the
+// leader. Without secret a node may only add itself as non-voter, like the
+// join of an observer. This grants less than the voter join of the raft binding
+// which every client of the broker can do, and an existing voter cannot be
+// demoted this way.
+func authenticateMembership(request membershipRequest, source string, secret string, members []Member) error {
+	if secret != "" && subtle.ConstantTimeCompare([]byte(request.Secret), []byte(secret)) == 1 {
+		return nil
+	}
+
+	if request.Op == MembershipAddNonvoter && request.NodeId == source {
+		voter := slices.ContainsFunc(members, func(member Member) bool { return member.Id == request.NodeId && member.Voter })
+		if !voter {
+			return nil
+		}
+	}
+
+	if secret == "" {
+		return errMembershipDisabled
+	}
+	return errMembershipNotAuthenticated
+}
+
+func (c *Connector) executeMembership(request membershipRequest) ([]Member, error) {
+	node := c.state.Node()
+	id := hraft.ServerID(request.NodeId)
+	// the raft transport uses the node id as address
+	address := hraft.ServerAddress(request.NodeId)
+
+	log.Printf("DdaClient: membership request %s %s", request.Op, request.NodeId)
+
+	switch request.Op {
+	case MembershipAddVoter:
+		return nil, node.AddVoter(id, address, 0, membershipTimeout).Error()
+	case MembershipAddNonvoter:
+		members, err := c.members()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.Id == request.NodeId && member.Voter {
+				return nil, node.DemoteVoter(id, 0, membershipTimeout).Error()
+			}
+		}
+		return nil, node.AddNonvoter(id, address, 0, membershipTimeout).Error()
+	case MembershipRemove:
+		return nil, node.RemoveServer(id, 0, membershipTimeout).Error()
+	case MembershipList:
+		return c.members()
+	default:
+		return nil, fmt.Errorf("unknown membership operation %s", request.Op)
+	}
+}
+
+func (c *Connector) members() ([]Member, error) {
+	node := c.state.Node()
+
+	future := node.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	_, leaderId := node.LeaderWithID()
+
+	members := make([]Member, 0)
+	for _, server := range future.Configuration().Servers {
+		members = append(members, Member{
+			Id:     string(server.ID),
+			Voter:  server.Suffrage == hraft.Voter,
+			Leader: server.ID == leaderId,
+		})
+	}
+
+	return members, nil
+}
+
+// The raft binding joins a cluster with a leader forwarded action. Type, id
+// and the msgpack encoded response are internals of the raft transport of
+// github.com/coatyio/dda v0.43.0 (services/state/raft/transport.go), there is
+// no supported hook to join as non-voter. TestDdaVersion fails on an upgrade,
+// TestObserverJoinsAsNonvoter if the join action changes.
+const (
+	raftLeaderForwardedType = "lfw"
+	raftAddVoter            = "av"
+)
+
+// raftAddVoterResponse is encoded like a response of the raft transport.
+type raftAddVoterResponse struct {
+	Response  *raft.AddVoterResponse
+	Error     string
+	Retryable bool
+}
+
+// comAdapter provides the communication service of an opened DDA to the raft
+// binding. Opening and closing is left to the DDA.
+type comAdapter struct {
+	*dda.Dda
+	// join replaces the add-voter request of the raft binding if set
+	join func(ctx context.Context) error
+}
+
+// PublishAction sends the join request of the raft binding to join if set. The
+// binding always joins as voter, observing nodes join as non-voter with it.
+func (a comAdapter) PublishAction(ctx context.Context, action api.Action, scope ...api.Scope) (<-chan api.ActionResult, error) {
+	if a.join != nil && action.Type == raftLeaderForwardedType && action.Id == raftAddVoter {
+		return joinResult(ctx, a.join), nil
+	}
+	return a.Dda.PublishAction(ctx, action, scope...)
+}
+
+// joinResult answers the join request of the raft binding with the result of
+// join. Without answer of the raft leader the channel is closed once ctx is
+// done, the binding retries then.
+func joinResult(ctx context.Context, join func(ctx context.Context) error) <-chan api.ActionResult {
+	results := make(chan api.ActionResult, 1)
+
+	go func() {
+		defer close(results)
+
+		err := join(ctx)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+
+		response := raftAddVoterResponse{Response: &raft.AddVoterResponse{}}
+		if err != nil {
+			response.Error = err.Error()
+		}
+		data, _ := raft.EncodeMsgPack(response)
+		results <- api.ActionResult{Data: data}
+	}()
+
+	return results
+}
+
+func (a comAdapter) Open(cfg *config.Config, timeout time.Duration) <-chan error {
+	ch := make(chan error, 1)
+	ch <- nil
+	close(ch)
+	return ch
+}
+
+func (a comAdapter) Close() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
@@ -0,0 +1,123 @@
+package dda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coatyio/dda/services/com/api"
+	"github.com/coatyio/dda/services/state/raft"
+	"runtime/debug"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateMembership(t *testing.T) {
+	members := []Member{{Id: "leader", Voter: true, Leader: true}, {Id: "voter", Voter: true}, {Id: "observer"}}
+
+	tests := []struct {
+		request membershipRequest
+		source  string
+		secret  string
+		err     error
+	}{
+		{membershipRequest{Op: MembershipList}, "cli", "", errMembershipDisabled},
+		{membershipRequest{Op: MembershipList, Secret: "guess"}, "cli", "secret", errMembershipNotAuthenticated},
+		{membershipRequest{Op: MembershipList}, "cli", "secret", errMembershipNotAuthenticated},
+		{membershipRequest{Op: MembershipList, Secret: "secret"}, "cli", "secret", nil},
+		{membershipRequest{Op: MembershipRemove, NodeId: "voter", Secret: "secret"}, "cli", "secret", nil},
+		// nodes join themselves as non-voter without secret
+		{membershipRequest{Op: MembershipAddNonvoter, NodeId: "new"}, "new", "", nil},
+		{membershipRequest{Op: MembershipAddNonvoter, NodeId: "observer"}, "observer", "secret", nil},
+		// but neither demote a voter nor add other nodes
+		{membershipRequest{Op: MembershipAddNonvoter, NodeId: "voter"}, "voter", "", errMembershipDisabled},
+		{membershipRequest{Op: MembershipAddNonvoter, NodeId: "new"}, "cli", "secret", errMembershipNotAuthenticated},
+		{membershipRequest{Op: MembershipAddVoter, NodeId: "new"}, "new", "secret", errMembershipNotAuthenticated},
+	}
+
+	for _, test := range tests {
+		if err := authenticateMembership(test.request, test.source, test.secret, members); err != test.err {
+			t.Errorf("Wrong result for %+v from %s: %v, expected %v", test.request, test.source, err, test.err)
+		}
+	}
+}
+
+// TestDdaVersion guards the join of observers, which relies on internals of
+// the raft transport of this DDA version, see comAdapter.
+func TestDdaVersion(t *testing.T) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Skip("no build info")
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/coatyio/dda" {
+			if dep.Version != "v0.43.0" {
+				t.Errorf("DDA %s, check raftLeaderForwardedType, raftAddVoter and raftAddVoterResponse against its raft transport", dep.Version)
+			}
+			return
+		}
+	}
+	t.Errorf("DDA dependency not found")
+}
+
+var errNoLeader = errors.New("no leader")
+
+// joinTestCom passes the actions of the raft transport to the adapter of an
+// observing node.
+type joinTestCom struct {
+	api.Api
+	adapter comAdapter
+}
+
+func (c joinTestCom) SubscribeAction(ctx context.Context, filter api.SubscriptionFilter) (<-chan api.ActionWithCallback, error) {
+	return make(chan api.ActionWithCallback), nil
+}
+
+func (c joinTestCom) PublishAction(ctx context.Context, action api.Action, scope ...api.Scope) (<-chan api.ActionResult, error) {
+	if action.Type != raftLeaderForwardedType || action.Id != raftAddVoter {
+		return nil, fmt.Errorf("join action %s/%s of the raft transport is not replaced", action.Type, action.Id)
+	}
+	return c.adapter.PublishAction(ctx, action, scope...)
+}
+
+func TestObserverJoinsAsNonvoter(t *testing.T) {
+	var joinErr error
+	var joins atomic.Int32
+	com := joinTestCom{adapter: comAdapter{join: func(ctx context.Context) error {
+		joins.Add(1)
+		if joinErr == errNoLeader {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return joinErr
+	}}}
+
+	transport := raft.NewRaftTransport(nil, "observer", com)
+	defer transport.Close()
+
+	addVoter := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		var response raft.AddVoterResponse
+		return transport.LfwAddVoter(ctx, &raft.AddVoterRequest{ServerId: "observer", ServerAddress: "observer"}, &response)
+	}
+
+	if err := addVoter(); err != nil {
+		t.Errorf("Join failed: %s", err)
+	}
+
+	joinErr = errMembershipNotAuthenticated
+	if err := addVoter(); err == nil || err.Error() != errMembershipNotAuthenticated.Error() {
+		t.Errorf("Wrong error of a rejected join: %v", err)
+	}
+
+	joinErr = errNoLeader
+	if err := addVoter(); err != context.DeadlineExceeded {
+		t.Errorf("Join without leader not retried: %v", err)
+	}
+
+	if joins.Load() != 3 {
+		t.Errorf("Add-voter requests were not replaced: %d joins", joins.Load())
+	}
+}
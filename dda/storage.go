@@ -0,0 +1,22 @@
+package dda
+
+import (
+	"github.com/coatyio/dda/services/state/raft"
+	hraft "github.com/hashicorp/raft"
+)
+
+// hasExistingState checks whether the data directory contains the raft log,
+// term or snapshots of a previous run. Memory backed state never exists.
+func hasExistingState(dataDir string) (bool, error) {
+	if dataDir == "" {
+		return false, nil
+	}
+
+	store, err := raft.NewRaftStore(dataDir)
+	if err != nil {
+		return false, err
+	}
+	defer store.Close(false)
+
+	return hraft.HasExistingState(store, store, store.SnapStore)
+}
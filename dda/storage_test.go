@@ -0,0 +1,32 @@
+package dda
+
+import (
+	"testing"
+
+	"github.com/coatyio/dda/services/state/raft"
+)
+
+func TestHasExistingState(t *testing.T) {
+	dataDir := t.TempDir()
+
+	if restored, err := hasExistingState(dataDir); err != nil || restored {
+		t.Fatalf("Empty data directory has state: %v, %v", restored, err)
+	}
+
+	store, err := raft.NewRaftStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetUint64([]byte("CurrentTerm"), 3); err != nil {
+		t.Fatal(err)
+	}
+	store.Close(false)
+
+	if restored, err := hasExistingState(dataDir); err != nil || !restored {
+		t.Errorf("Persisted term not detected: %v, %v", restored, err)
+	}
+
+	if restored, _ := hasExistingState(""); restored {
+		t.Errorf("Memory backed state is restored")
+	}
+}
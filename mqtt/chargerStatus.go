@@ -0,0 +1,105 @@
+package mqtt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+// chargerStatusMapping is a validated common.ChargerStatusMapping with the
+// resolved topic.
+type chargerStatusMapping struct {
+	topic         string
+	chargingPower *mapping
+	sessionEnergy *mapping
+	plugged       []string
+	errorCodes    []string
+}
+
+func newChargerStatusMapping(config *common.Config, statusMapping common.ChargerStatusMapping) (*chargerStatusMapping, error) {
+	topic, err := resolveTopic(config, statusMapping.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	m := chargerStatusMapping{topic: topic}
+
+	// only the position and unit of the values are used
+	statusMapping.ChargingPower.Topic = ""
+	statusMapping.SessionEnergy.Topic = ""
+	if m.chargingPower, err = newMapping(config, statusMapping.ChargingPower); err != nil {
+		return nil, fmt.Errorf("charging power: %w", err)
+	}
+	if m.sessionEnergy, err = newMapping(config, statusMapping.SessionEnergy); err != nil {
+		return nil, fmt.Errorf("session energy: %w", err)
+	}
+
+	if statusMapping.Plugged != "" {
+		m.plugged = strings.Split(statusMapping.Plugged, ".")
+	}
+	if statusMapping.ErrorCodes != "" {
+		m.errorCodes = strings.Split(statusMapping.ErrorCodes, ".")
+	}
+
+	return &m, nil
+}
+
+// decode extracts the charger status from a device payload.
+func (m *chargerStatusMapping) decode(payload []byte) (common.ChargerStatus, error) {
+	status := common.ChargerStatus{Timestamp: time.Now()}
+
+	data, err := parsePayload(payload, true)
+	if err != nil {
+		return status, err
+	}
+
+	if status.ChargingPower, err = m.chargingPower.value(data); err != nil {
+		return status, fmt.Errorf("charging power: %w", err)
+	}
+	if status.SessionEnergy, err = m.sessionEnergy.value(data); err != nil {
+		return status, fmt.Errorf("session energy: %w", err)
+	}
+
+	plugged, err := lookup(data, m.plugged)
+	if err != nil {
+		return status, fmt.Errorf("plugged: %w", err)
+	}
+	switch v := plugged.(type) {
+	case bool:
+		status.Plugged = v
+	case float64:
+		status.Plugged = v != 0
+	case string:
+		if status.Plugged, err = strconv.ParseBool(strings.TrimSpace(v)); err != nil {
+			return status, fmt.Errorf("plugged: %w", err)
+		}
+	default:
+		return status, fmt.Errorf("plugged: %v is not a plug state", plugged)
+	}
+
+	if len(m.errorCodes) == 0 {
+		return status, nil
+	}
+
+	errorCodes, err := lookup(data, m.errorCodes)
+	if err != nil {
+		// no errors
+		return status, nil
+	}
+	switch v := errorCodes.(type) {
+	case []any:
+		for _, errorCode := range v {
+			status.ErrorCodes = append(status.ErrorCodes, fmt.Sprint(errorCode))
+		}
+	case nil:
+	default:
+		if errorCode := fmt.Sprint(v); errorCode != "" {
+			status.ErrorCodes = []string{errorCode}
+		}
+	}
+
+	return status, nil
+}
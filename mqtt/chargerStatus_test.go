@@ -0,0 +1,91 @@
+package mqtt
+
+import (
+	"slices"
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestChargerStatusDecode(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "charger1"
+
+	m, err := newChargerStatusMapping(config, config.Mqtt.ChargerStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.topic != "charger1/chargerStatus" {
+		t.Errorf("Wrong topic: %s", m.topic)
+	}
+
+	status, err := m.decode([]byte(`{"chargingPower": 7200, "plugged": true, "sessionEnergy": 1500, "errorCodes": ["E1", 42]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChargingPower != 7200 || !status.Plugged || status.SessionEnergy != 1500 || !slices.Equal(status.ErrorCodes, []string{"E1", "42"}) {
+		t.Errorf("Wrong status: %+v", status)
+	}
+
+	status, err = m.decode([]byte(`{"chargingPower": "0", "plugged": 0, "sessionEnergy": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Plugged || len(status.ErrorCodes) != 0 {
+		t.Errorf("Wrong status without errors: %+v", status)
+	}
+
+	if _, err := m.decode([]byte(`{"chargingPower": 0, "sessionEnergy": 0}`)); err == nil {
+		t.Errorf("Missing plug state not detected")
+	}
+}
+
+func TestChargerStatusUnits(t *testing.T) {
+	config := common.NewConfig()
+	statusMapping := common.ChargerStatusMapping{
+		Topic:         "{{.Id}}/state",
+		ChargingPower: common.PayloadMapping{Path: "evse.power", Unit: "kW"},
+		SessionEnergy: common.PayloadMapping{Path: "evse.energy", Unit: "kWh"},
+		Plugged:       "evse.connected",
+		ErrorCodes:    "evse.error",
+	}
+
+	m, err := newChargerStatusMapping(config, statusMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.decode([]byte(`{"evse": {"power": 3.7, "energy": 12.5, "connected": "true", "error": "F12"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChargingPower != 3700 || status.SessionEnergy != 12500 || !status.Plugged || !slices.Equal(status.ErrorCodes, []string{"F12"}) {
+		t.Errorf("Wrong status: %+v", status)
+	}
+}
+
+func TestChargerStatusLatestOnly(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "charger1"
+
+	c, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.chargerStatusChannel = make(chan common.ChargerStatus, 1)
+
+	// the router handler does not block without reader
+	c.publishChargerStatus(common.ChargerStatus{ChargingPower: 1000})
+	c.publishChargerStatus(common.ChargerStatus{ChargingPower: 2000})
+	if status := <-c.chargerStatusChannel; status.ChargingPower != 2000 {
+		t.Errorf("Latest status not kept: %+v", status)
+	}
+
+	// a status arriving during shutdown is dropped
+	c.closeChargerStatus()
+	c.publishChargerStatus(common.ChargerStatus{ChargingPower: 3000})
+	if _, ok := <-c.chargerStatusChannel; ok {
+		t.Errorf("Status sent after close")
+	}
+}
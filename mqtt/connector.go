@@ -2,10 +2,13 @@ package mqtt
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"slices"
+	"sync"
+	"time"
 
 	"code.siemens.com/energy-community-controller/common"
 	"github.com/coatyio/dda/plog"
@@ -13,12 +16,61 @@ import (
 	"github.com/eclipse/paho.golang/paho"
 )
 
+// statusTimeout bounds status updates, leader changes must not block the
+// leader election
+const statusTimeout = time.Second
+
+// replayTimeout bounds the publishing of a queued message after a reconnect
+const replayTimeout = 10 * time.Second
+
+// publishTimeout bounds the publishing of a new message, it is queued if the
+// broker does not acknowledge it in time
+const publishTimeout = 5 * time.Second
+
+// ErrQueued is returned if a message could not be delivered to the broker. It
+// is published after the next reconnect unless a newer message for the same
+// topic replaces it.
+var ErrQueued = errors.New("broker not reachable, message queued")
+
+var errNotQueued = errors.New("broker not reachable, message dropped as queueing is disabled")
+
 type Connector struct {
-	config              *common.Config
-	cliCfg              autopaho.ClientConfig
-	mqttConnection      *autopaho.ConnectionManager
-	router              paho.Router
-	pvProductionChannel chan float64
+	config               *common.Config
+	cliCfg               autopaho.ClientConfig
+	mqttConnection       *autopaho.ConnectionManager
+	router               paho.Router
+	pvProductionChannel  chan float64
+	chargerStatusChannel chan common.ChargerStatus
+
+	// the latest charger status is kept in chargerStatusChannel, the router
+	// handler never blocks on it and stops sending once the connector is
+	// closed
+	chargerStatusMu     sync.Mutex
+	chargerStatusClosed bool
+
+	production       *mapping
+	chargingSetPoint *mapping
+	productionLimit  *mapping
+	chargerStatus    *chargerStatusMapping
+
+	// publishMu serializes publishing queued and new messages, so a replayed
+	// message never overtakes a newer one for the same topic
+	publishMu sync.Mutex
+	outbox    *outbox
+
+	subscriptionsMu sync.Mutex
+	subscriptions   []paho.SubscribeOptions
+
+	statusTopic             string
+	allocationStrategyTopic string
+	statusMu                sync.Mutex
+	status                  Status
+
+	// allocationStrategy is changed by the Home Assistant select, changes
+	// are passed to the controller on allocationStrategyChannel
+	allocationStrategyMu      sync.Mutex
+	allocationStrategy        string
+	allocationStrategyChannel chan string
 }
 
 func NewConnector(config *common.Config) (*Connector, error) {
@@ -27,12 +79,42 @@ func NewConnector(config *common.Config) (*Connector, error) {
 		return nil, err
 	}
 
-	connector := Connector{config: config, router: paho.NewStandardRouter()}
+	connector := Connector{config: config, router: paho.NewStandardRouter(), outbox: newOutbox(config.Mqtt.QueueSize), allocationStrategy: config.Controller.AllocationStrategy, allocationStrategyChannel: make(chan string, 1)}
+
+	if connector.production, err = newMapping(config, config.Mqtt.Production); err != nil {
+		return nil, fmt.Errorf("production mapping: %w", err)
+	}
+	if connector.chargingSetPoint, err = newMapping(config, config.Mqtt.ChargingSetPoint); err != nil {
+		return nil, fmt.Errorf("charging set point mapping: %w", err)
+	}
+	if connector.productionLimit, err = newMapping(config, config.Mqtt.ProductionLimit); err != nil {
+		return nil, fmt.Errorf("production limit mapping: %w", err)
+	}
+	if connector.chargerStatus, err = newChargerStatusMapping(config, config.Mqtt.ChargerStatus); err != nil {
+		return nil, fmt.Errorf("charger status mapping: %w", err)
+	}
+	if connector.statusTopic, err = resolveTopic(config, config.Mqtt.StatusTopic); err != nil {
+		return nil, fmt.Errorf("status topic: %w", err)
+	}
+	connector.status = newStatus()
+	if connector.allocationStrategyTopic, err = resolveTopic(config, config.Mqtt.Discovery.AllocationStrategyTopic); err != nil {
+		return nil, fmt.Errorf("allocation strategy topic: %w", err)
+	}
 
 	connector.cliCfg = autopaho.ClientConfig{
-		BrokerUrls:     []*url.URL{u},
-		KeepAlive:      20,
-		OnConnectionUp: func(cm *autopaho.ConnectionManager, connAck *paho.Connack) { log.Println("mqtt connection up") },
+		BrokerUrls: []*url.URL{u},
+		KeepAlive:  20,
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, connAck *paho.Connack) {
+			log.Printf("mqtt connection up, session present: %t", connAck.SessionPresent)
+			go func() {
+				if !connAck.SessionPresent {
+					connector.resubscribe(cm)
+				}
+				// the last will may have replaced the status while disconnected
+				connector.publishStatus(context.Background(), cm)
+				connector.replay(cm)
+			}()
+		},
 		OnConnectError: func(err error) { plog.Printf("error whilst attempting connection: %s", err) },
 		ClientConfig: paho.ClientConfig{
 			ClientID:      config.Id,
@@ -48,6 +130,29 @@ func NewConnector(config *common.Config) (*Connector, error) {
 		},
 	}
 
+	if config.Mqtt.SessionExpiryInterval > 0 {
+		sessionExpiryInterval := uint32(config.Mqtt.SessionExpiryInterval.Seconds())
+		connector.cliCfg.SetConnectPacketConfigurator(func(connect *paho.Connect) *paho.Connect {
+			connect.CleanStart = false
+			if connect.Properties == nil {
+				connect.Properties = &paho.ConnectProperties{}
+			}
+			connect.Properties.SessionExpiryInterval = &sessionExpiryInterval
+			return connect
+		})
+	}
+
+	connector.cliCfg.SetWillMessage(connector.statusTopic, newStatus().offline().payload(), 1, true)
+
+	// only used for ssl://, mqtts:// and wss:// urls
+	if connector.cliCfg.TlsCfg, err = config.Auth.TLSConfig(); err != nil {
+		return nil, err
+	}
+
+	if config.Auth.Username != "" || config.Auth.Password != "" {
+		connector.cliCfg.SetUsernamePassword(config.Auth.Username, []byte(config.Auth.Password))
+	}
+
 	return &connector, nil
 }
 
@@ -70,50 +175,257 @@ func (c *Connector) Close() {
 	if c.pvProductionChannel != nil {
 		close(c.pvProductionChannel)
 	}
+	c.closeChargerStatus()
+
+	// the broker does not publish the last will on a regular disconnect
+	c.statusMu.Lock()
+	c.status = c.status.offline()
+	c.statusMu.Unlock()
+
+	if err := c.publishStatus(context.Background(), c.mqttConnection); err != nil {
+		log.Printf("Could not publish offline status, %s", err)
+	}
+
+	metrics := c.Metrics()
+	log.Printf("Outbound queue: %d queued, %d dropped, %d replayed", metrics.Queued, metrics.Dropped, metrics.Replayed)
+
 	c.mqttConnection.Disconnect(context.Background())
 }
 
-func (c *Connector) PublishChargingSetPoint(ctx context.Context, chargingSetPoint float64) error {
-	chargingSetPointMessage := chargingSetPointMessage{ChargingSetPoint: chargingSetPoint}
-	payload, _ := json.Marshal(chargingSetPointMessage)
+// SetLeader updates the role in the status of the node.
+func (c *Connector) SetLeader(ctx context.Context, isLeader bool) error {
+	return c.updateStatus(ctx, func(s *Status) {
+		s.Role = ROLE_FOLLOWER
+		if isLeader {
+			s.Role = ROLE_LEADER
+		}
+	})
+}
+
+// SetRegistered updates the registration in the status of the node.
+func (c *Connector) SetRegistered(ctx context.Context, registered bool) error {
+	return c.updateStatus(ctx, func(s *Status) {
+		s.Registration = REGISTRATION_UNREGISTERED
+		if registered {
+			s.Registration = REGISTRATION_REGISTERED
+		}
+	})
+}
+
+func (c *Connector) updateStatus(ctx context.Context, update func(s *Status)) error {
+	c.statusMu.Lock()
+	update(&c.status)
+	c.statusMu.Unlock()
+
+	return c.publishStatus(ctx, c.mqttConnection)
+}
+
+func (c *Connector) publishStatus(ctx context.Context, cm *autopaho.ConnectionManager) error {
+	if cm == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, statusTimeout)
+	defer cancel()
 
-	_, err := c.mqttConnection.Publish(ctx, &paho.Publish{
+	c.statusMu.Lock()
+	c.status.Timestamp = time.Now()
+	payload := c.status.payload()
+	c.statusMu.Unlock()
+
+	_, err := cm.Publish(ctx, &paho.Publish{
 		QoS:     1,
-		Topic:   fmt.Sprintf("%s/%s", c.config.Id, charging_set_point_topic),
+		Retain:  true,
+		Topic:   c.statusTopic,
 		Payload: payload,
 	})
 
 	return err
 }
 
+func (c *Connector) PublishChargingSetPoint(ctx context.Context, chargingSetPoint float64) error {
+	payload, err := c.chargingSetPoint.encode(chargingSetPoint)
+	if err != nil {
+		return err
+	}
+
+	return c.publishQueued(ctx, outboxMessage{topic: c.chargingSetPoint.topic, payload: payload, qos: 1})
+}
+
+// PublishProductionLimit curtails the PV production to limit W, the payload
+// has null as value if the curtailment is lifted.
+func (c *Connector) PublishProductionLimit(ctx context.Context, limit float64, curtailed bool) error {
+	payload, err := c.productionLimit.encodeNull()
+	if curtailed {
+		payload, err = c.productionLimit.encode(limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.publishQueued(ctx, outboxMessage{topic: c.productionLimit.topic, payload: payload, qos: 1})
+}
+
+// publishQueued publishes a message or queues it until the connection to the
+// broker is up again. It returns ErrQueued if the message was queued.
+func (c *Connector) publishQueued(ctx context.Context, message outboxMessage) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+
+	if c.mqttConnection == nil {
+		return c.queue(message)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	if _, err := c.mqttConnection.Publish(ctx, &paho.Publish{QoS: message.qos, Topic: message.topic, Payload: message.payload}); err != nil {
+		log.Printf("Could not publish to %s: %s", message.topic, err)
+		return c.queue(message)
+	}
+
+	c.outbox.remove(message.topic)
+	return nil
+}
+
+func (c *Connector) queue(message outboxMessage) error {
+	if !c.outbox.add(message) {
+		return errNotQueued
+	}
+	return ErrQueued
+}
+
+// replay publishes the queued messages after a reconnect.
+func (c *Connector) replay(cm *autopaho.ConnectionManager) {
+	for {
+		c.publishMu.Lock()
+		message, ok := c.outbox.pop()
+		if !ok {
+			c.publishMu.Unlock()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+		_, err := cm.Publish(ctx, &paho.Publish{QoS: message.qos, Topic: message.topic, Payload: message.payload})
+		cancel()
+
+		if err != nil {
+			c.outbox.requeue(message)
+			c.publishMu.Unlock()
+			log.Printf("Could not replay queued message for %s: %s", message.topic, err)
+			return
+		}
+
+		c.outbox.markReplayed()
+		c.publishMu.Unlock()
+	}
+}
+
+// Metrics returns the counters of the outbound queue.
+func (c *Connector) Metrics() Metrics {
+	return c.outbox.metrics()
+}
+
+// subscribe subscribes to topic and remembers the subscription for
+// reconnects without session.
+func (c *Connector) subscribe(ctx context.Context, topic string) error {
+	subscription := paho.SubscribeOptions{Topic: topic, QoS: 1}
+	if _, err := c.mqttConnection.Subscribe(ctx, &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{subscription}}); err != nil {
+		return err
+	}
+
+	c.subscriptionsMu.Lock()
+	c.subscriptions = append(c.subscriptions, subscription)
+	c.subscriptionsMu.Unlock()
+
+	return nil
+}
+
+// resubscribe restores the subscriptions if the broker did not keep the
+// session.
+func (c *Connector) resubscribe(cm *autopaho.ConnectionManager) {
+	c.subscriptionsMu.Lock()
+	subscriptions := slices.Clone(c.subscriptions)
+	c.subscriptionsMu.Unlock()
+
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+	if _, err := cm.Subscribe(ctx, &paho.Subscribe{Subscriptions: subscriptions}); err != nil {
+		log.Printf("Could not restore subscriptions: %s", err)
+	}
+}
+
 func (c *Connector) SubscribeToPvProduction(ctx context.Context) (<-chan float64, error) {
 	c.pvProductionChannel = make(chan float64)
-	topic := fmt.Sprintf("%s/%s", c.config.Id, production_topic)
+	topic := c.production.topic
 
 	c.router.RegisterHandler(topic, func(p *paho.Publish) {
-		var msg pvProductionMessage
-		if err := json.Unmarshal(p.Payload, &msg); err != nil {
-			log.Printf("Could not unmarshal incomming pv production message, %s", err)
+		production, err := c.production.decode(p.Payload)
+		if err != nil {
+			log.Printf("Could not decode incomming pv production message, %s", err)
 			return
 		}
-		c.pvProductionChannel <- msg.Production
+		c.pvProductionChannel <- production
 	})
 
-	if _, err := c.mqttConnection.Subscribe(ctx, &paho.Subscribe{Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 1}}}); err != nil {
+	if err := c.subscribe(ctx, topic); err != nil {
 		return nil, err
 	}
 
 	return c.pvProductionChannel, nil
 }
 
-const production_topic = "production"
+// SubscribeToChargerStatus reports the status of the charger. Only the latest
+// status is kept if the channel is not read in time.
+func (c *Connector) SubscribeToChargerStatus(ctx context.Context) (<-chan common.ChargerStatus, error) {
+	c.chargerStatusMu.Lock()
+	c.chargerStatusChannel = make(chan common.ChargerStatus, 1)
+	c.chargerStatusMu.Unlock()
+	topic := c.chargerStatus.topic
+
+	c.router.RegisterHandler(topic, func(p *paho.Publish) {
+		status, err := c.chargerStatus.decode(p.Payload)
+		if err != nil {
+			log.Printf("Could not decode incomming charger status message, %s", err)
+			return
+		}
+		c.publishChargerStatus(status)
+	})
+
+	if err := c.subscribe(ctx, topic); err != nil {
+		return nil, err
+	}
+
+	return c.chargerStatusChannel, nil
+}
+
+func (c *Connector) closeChargerStatus() {
+	c.chargerStatusMu.Lock()
+	defer c.chargerStatusMu.Unlock()
 
-type pvProductionMessage struct {
-	Production float64 `json:"production"`
+	if c.chargerStatusChannel != nil && !c.chargerStatusClosed {
+		close(c.chargerStatusChannel)
+	}
+	c.chargerStatusClosed = true
 }
 
-const charging_set_point_topic = "chargingSetPoint"
+// publishChargerStatus replaces an unread status, it does nothing once the
+// connector is closed.
+func (c *Connector) publishChargerStatus(status common.ChargerStatus) {
+	c.chargerStatusMu.Lock()
+	defer c.chargerStatusMu.Unlock()
 
-type chargingSetPointMessage struct {
-	ChargingSetPoint float64 `json:"chargingSetPoint"`
+	if c.chargerStatusClosed {
+		return
+	}
+
+	select {
+	case <-c.chargerStatusChannel:
+	default:
+	}
+	c.chargerStatusChannel <- status
 }
@@ -0,0 +1,50 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestPublishQueuedWithoutConnection(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "node1"
+	config.Url = "tcp://localhost:1883"
+
+	connector, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := connector.PublishProductionLimit(context.Background(), 1000, true); !errors.Is(err, ErrQueued) {
+		t.Errorf("Expected ErrQueued, got %v", err)
+	}
+	if err := connector.PublishChargingSetPoint(context.Background(), 7400); !errors.Is(err, ErrQueued) {
+		t.Errorf("Expected ErrQueued, got %v", err)
+	}
+
+	if metrics := connector.Metrics(); metrics.Queued != 2 {
+		t.Errorf("Wrong number of queued messages: %+v", metrics)
+	}
+}
+
+func TestPublishWithoutQueue(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "node1"
+	config.Url = "tcp://localhost:1883"
+	config.Mqtt.QueueSize = 0
+
+	connector, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := connector.PublishProductionLimit(context.Background(), 1000, true); err == nil || errors.Is(err, ErrQueued) {
+		t.Errorf("Expected a dropped message, got %v", err)
+	}
+	if metrics := connector.Metrics(); metrics.Queued != 0 || metrics.Dropped != 1 {
+		t.Errorf("Wrong metrics: %+v", metrics)
+	}
+}
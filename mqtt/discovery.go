@@ -0,0 +1,223 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// discoveryDevice groups the entities of a node in Home Assistant.
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Model        string   `json:"model"`
+	Manufacturer string   `json:"manufacturer"`
+	SwVersion    string   `json:"sw_version"`
+}
+
+// discoveryConfig is the payload of a Home Assistant MQTT discovery message,
+// see https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+type discoveryConfig struct {
+	Name                string          `json:"name"`
+	UniqueId            string          `json:"unique_id"`
+	ObjectId            string          `json:"object_id"`
+	Device              discoveryDevice `json:"device"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	AvailabilityTmpl    string          `json:"availability_template"`
+	PayloadAvailable    string          `json:"payload_available"`
+	PayloadNotAvailable string          `json:"payload_not_available"`
+	StateTopic          string          `json:"state_topic"`
+	ValueTemplate       string          `json:"value_template,omitempty"`
+	CommandTopic        string          `json:"command_topic,omitempty"`
+	DeviceClass         string          `json:"device_class,omitempty"`
+	StateClass          string          `json:"state_class,omitempty"`
+	UnitOfMeasurement   string          `json:"unit_of_measurement,omitempty"`
+	PayloadOn           string          `json:"payload_on,omitempty"`
+	PayloadOff          string          `json:"payload_off,omitempty"`
+	Options             []string        `json:"options,omitempty"`
+}
+
+type discoveryEntity struct {
+	component string
+	objectId  string
+	config    discoveryConfig
+}
+
+// discoveryEntities returns the entities of a node with the given
+// capabilities.
+func (c *Connector) discoveryEntities(capabilities []string) []discoveryEntity {
+	device := discoveryDevice{
+		Identifiers:  []string{c.config.Id},
+		Name:         c.config.Name + " " + c.config.Id,
+		Model:        c.config.Name,
+		Manufacturer: "Siemens",
+		SwVersion:    common.Version,
+	}
+
+	entity := func(component string, objectId string, name string, config discoveryConfig) discoveryEntity {
+		config.Name = name
+		config.UniqueId = c.config.Id + "_" + objectId
+		config.ObjectId = config.UniqueId
+		config.Device = device
+		config.AvailabilityTopic = c.statusTopic
+		config.AvailabilityTmpl = "{{ value_json.State }}"
+		config.PayloadAvailable = STATUS_ONLINE
+		config.PayloadNotAvailable = STATUS_OFFLINE
+		return discoveryEntity{component: component, objectId: objectId, config: config}
+	}
+
+	var entities []discoveryEntity
+
+	if slices.Contains(capabilities, common.CAPABILITY_PRODUCTION) {
+		entities = append(entities, entity("sensor", "production", "PV production", discoveryConfig{
+			StateTopic:        c.production.topic,
+			ValueTemplate:     c.production.valueTemplate(),
+			DeviceClass:       "power",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "W",
+		}))
+	}
+
+	if slices.Contains(capabilities, common.CAPABILITY_CHARGING_SET_POINT) {
+		entities = append(entities, entity("sensor", "charging_set_point", "Charging set point", discoveryConfig{
+			StateTopic:        c.chargingSetPoint.topic,
+			ValueTemplate:     c.chargingSetPoint.valueTemplate(),
+			DeviceClass:       "power",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "W",
+		}))
+	}
+
+	entities = append(entities, entity("binary_sensor", "leader", "Leader", discoveryConfig{
+		StateTopic:    c.statusTopic,
+		ValueTemplate: "{{ value_json.Role }}",
+		PayloadOn:     ROLE_LEADER,
+		PayloadOff:    ROLE_FOLLOWER,
+	}))
+
+	// only leader candidates run a controller which uses the strategy
+	if c.config.Leader.Enabled {
+		entities = append(entities, entity("select", "allocation_strategy", "Allocation strategy", discoveryConfig{
+			StateTopic:   c.allocationStrategyTopic,
+			CommandTopic: c.allocationStrategyTopic + "/set",
+			Options:      common.ALLOCATION_STRATEGIES,
+		}))
+	}
+
+	return entities
+}
+
+// PublishDiscovery publishes retained Home Assistant discovery configs for the
+// entities of a node with the given capabilities, the leader status and, on
+// leader candidates, the allocation strategy.
+func (c *Connector) PublishDiscovery(ctx context.Context, capabilities []string) error {
+	for _, entity := range c.discoveryEntities(capabilities) {
+		payload, err := json.Marshal(entity.config)
+		if err != nil {
+			return err
+		}
+
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", c.config.Mqtt.Discovery.Prefix, entity.component, c.config.Id, entity.objectId)
+		if _, err := c.mqttConnection.Publish(ctx, &paho.Publish{QoS: 1, Retain: true, Topic: topic, Payload: payload}); err != nil {
+			return err
+		}
+	}
+
+	if !c.config.Leader.Enabled {
+		return nil
+	}
+
+	return c.serveAllocationStrategy(ctx)
+}
+
+// serveAllocationStrategy publishes the allocation strategy and changes it on
+// commands of the select. Unknown strategies are rejected, the state is
+// published again so the select shows the strategy in force.
+func (c *Connector) serveAllocationStrategy(ctx context.Context) error {
+	commandTopic := c.allocationStrategyTopic + "/set"
+	c.router.RegisterHandler(commandTopic, func(p *paho.Publish) {
+		if requested := string(p.Payload); !slices.Contains(common.ALLOCATION_STRATEGIES, requested) {
+			log.Printf("Unknown allocation strategy %q requested", requested)
+		} else {
+			c.setAllocationStrategy(requested)
+		}
+
+		// the router waits for the handler, publishing in it would block
+		// the acknowledgement
+		go func() {
+			if err := c.publishAllocationStrategy(ctx); err != nil {
+				log.Printf("Could not publish allocation strategy, %s", err)
+			}
+		}()
+	})
+
+	if err := c.subscribe(ctx, commandTopic); err != nil {
+		return err
+	}
+
+	return c.publishAllocationStrategy(ctx)
+}
+
+func (c *Connector) setAllocationStrategy(strategy string) {
+	c.allocationStrategyMu.Lock()
+	defer c.allocationStrategyMu.Unlock()
+
+	if strategy == c.allocationStrategy {
+		return
+	}
+
+	log.Printf("Allocation strategy changed to %q", strategy)
+	c.allocationStrategy = strategy
+
+	// only the latest strategy is of interest, replace an unread one
+	select {
+	case <-c.allocationStrategyChannel:
+	default:
+	}
+	c.allocationStrategyChannel <- strategy
+}
+
+func (c *Connector) publishAllocationStrategy(ctx context.Context) error {
+	c.allocationStrategyMu.Lock()
+	strategy := c.allocationStrategy
+	c.allocationStrategyMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	_, err := c.mqttConnection.Publish(ctx, &paho.Publish{QoS: 1, Retain: true, Topic: c.allocationStrategyTopic, Payload: []byte(strategy)})
+	return err
+}
+
+// AllocationStrategyCh reports the allocation strategies selected in Home
+// Assistant.
+func (c *Connector) AllocationStrategyCh() <-chan string {
+	return c.allocationStrategyChannel
+}
+
+// valueTemplate is a Home Assistant template extracting the value in W from a
+// device payload.
+func (m *mapping) valueTemplate() string {
+	var value strings.Builder
+	if len(m.path) == 0 {
+		value.WriteString("value")
+	} else {
+		value.WriteString("value_json")
+		for _, key := range m.path {
+			if _, err := strconv.Atoi(key); err == nil {
+				fmt.Fprintf(&value, "[%s]", key)
+			} else {
+				fmt.Fprintf(&value, "[%q]", key)
+			}
+		}
+	}
+
+	return fmt.Sprintf("{{ (%s | float) * %s }}", value.String(), strconv.FormatFloat(m.factor, 'f', -1, 64))
+}
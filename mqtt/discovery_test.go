@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestValueTemplate(t *testing.T) {
+	config := common.NewConfig()
+
+	tests := []struct {
+		mapping  common.PayloadMapping
+		expected string
+	}{
+		{common.PayloadMapping{Topic: "t", Path: "production", Unit: "W"}, `{{ (value_json["production"] | float) * 1 }}`},
+		{common.PayloadMapping{Topic: "t", Path: "data.ac.0.power", Unit: "kW"}, `{{ (value_json["data"]["ac"][0]["power"] | float) * 1000 }}`},
+		{common.PayloadMapping{Topic: "t", Scale: 0.1}, `{{ (value | float) * 0.1 }}`},
+	}
+
+	for _, test := range tests {
+		m, err := newMapping(config, test.mapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if template := m.valueTemplate(); template != test.expected {
+			t.Errorf("Wrong value template: %s, expected %s", template, test.expected)
+		}
+	}
+}
+
+func TestDiscoveryEntities(t *testing.T) {
+	config := common.NewConfig()
+	config.Name = "pv"
+	config.Id = "node1"
+
+	c, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entities := c.discoveryEntities([]string{common.CAPABILITY_PRODUCTION})
+	if len(entities) != 2 {
+		t.Fatalf("Wrong number of entities: %d", len(entities))
+	}
+
+	production := entities[0]
+	if production.component != "sensor" || production.config.StateTopic != "node1/production" || production.config.UniqueId != "node1_production" {
+		t.Errorf("Wrong production entity: %+v", production)
+	}
+	if production.config.AvailabilityTopic != "node1/status" || production.config.Device.Identifiers[0] != "node1" {
+		t.Errorf("Wrong availability or device: %+v", production.config)
+	}
+
+	leader := entities[1]
+	if leader.component != "binary_sensor" || leader.config.PayloadOn != ROLE_LEADER {
+		t.Errorf("Wrong leader entity: %+v", leader)
+	}
+
+	config.Leader.Enabled = true
+	entities = c.discoveryEntities([]string{common.CAPABILITY_PRODUCTION})
+	if len(entities) != 3 {
+		t.Fatalf("Wrong number of entities of a leader candidate: %d", len(entities))
+	}
+
+	strategy := entities[2]
+	if strategy.component != "select" || strategy.config.StateTopic != "node1/allocationStrategy" || strategy.config.CommandTopic != "node1/allocationStrategy/set" || len(strategy.config.Options) == 0 {
+		t.Errorf("Wrong allocation strategy entity: %+v", strategy)
+	}
+}
+
+func TestSetAllocationStrategy(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "node1"
+
+	c, err := NewConnector(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.setAllocationStrategy(common.ALLOCATION_STRATEGY_EQUAL)
+	select {
+	case strategy := <-c.AllocationStrategyCh():
+		t.Errorf("Unchanged strategy %s reported", strategy)
+	default:
+	}
+
+	c.setAllocationStrategy("a")
+	c.setAllocationStrategy("b")
+	if strategy := <-c.AllocationStrategyCh(); strategy != "b" {
+		t.Errorf("Latest strategy not reported: %s", strategy)
+	}
+}
@@ -0,0 +1,177 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+var unitFactors = map[string]float64{
+	"":    1,
+	"W":   1,
+	"kW":  1000,
+	"MW":  1000000,
+	"Wh":  1,
+	"kWh": 1000,
+	"MWh": 1000000,
+}
+
+// mapping is a validated common.PayloadMapping with the resolved topic.
+type mapping struct {
+	topic    string
+	path     []string
+	factor   float64
+	asString bool
+}
+
+// resolveTopic replaces the node configuration in a topic template.
+func resolveTopic(config *common.Config, topicTemplate string) (string, error) {
+	t, err := template.New("topic").Option("missingkey=error").Parse(topicTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid topic template %q: %w", topicTemplate, err)
+	}
+
+	var topic bytes.Buffer
+	if err := t.Execute(&topic, config); err != nil {
+		return "", fmt.Errorf("invalid topic template %q: %w", topicTemplate, err)
+	}
+
+	return topic.String(), nil
+}
+
+func newMapping(config *common.Config, payloadMapping common.PayloadMapping) (*mapping, error) {
+	topic, err := resolveTopic(config, payloadMapping.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	unitFactor, ok := unitFactors[payloadMapping.Unit]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", payloadMapping.Unit)
+	}
+
+	scale := payloadMapping.Scale
+	if scale == 0 {
+		scale = 1
+	}
+
+	m := mapping{topic: topic, factor: scale * unitFactor, asString: payloadMapping.AsString}
+	if payloadMapping.Path != "" {
+		m.path = strings.Split(payloadMapping.Path, ".")
+	}
+
+	return &m, nil
+}
+
+// decode extracts the value in W from a device payload.
+func (m *mapping) decode(payload []byte) (float64, error) {
+	data, err := parsePayload(payload, len(m.path) > 0)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.value(data)
+}
+
+// value extracts the value in W from a parsed device payload.
+func (m *mapping) value(data any) (float64, error) {
+	data, err := lookup(data, m.path)
+	if err != nil {
+		return 0, err
+	}
+
+	var value float64
+	switch v := data.(type) {
+	case float64:
+		value = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, err
+		}
+		value = parsed
+	default:
+		return 0, fmt.Errorf("value %v is not a number", data)
+	}
+
+	return value * m.factor, nil
+}
+
+// parsePayload parses a JSON payload. Payloads which are no JSON are plain
+// text values if no JSON is required.
+func parsePayload(payload []byte, jsonRequired bool) (any, error) {
+	var data any
+	if err := json.Unmarshal(payload, &data); err != nil {
+		if jsonRequired {
+			return nil, err
+		}
+		data = strings.TrimSpace(string(payload))
+	}
+
+	return data, nil
+}
+
+// lookup resolves a JSON path of object keys and array indices.
+func lookup(data any, path []string) (any, error) {
+	for _, key := range path {
+		switch node := data.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found", key)
+			}
+			data = value
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("invalid index %q", key)
+			}
+			data = node[i]
+		default:
+			return nil, fmt.Errorf("cannot resolve %q in %v", key, node)
+		}
+	}
+
+	return data, nil
+}
+
+// encode creates a device payload from a value in W.
+func (m *mapping) encode(value float64) ([]byte, error) {
+	var data any = value / m.factor
+	if m.asString {
+		data = strconv.FormatFloat(value/m.factor, 'f', -1, 64)
+	}
+
+	return m.wrap(data)
+}
+
+// encodeNull creates a device payload with null as value, e.g. to lift a
+// limit.
+func (m *mapping) encodeNull() ([]byte, error) {
+	return m.wrap(nil)
+}
+
+func (m *mapping) wrap(data any) ([]byte, error) {
+	for i := len(m.path) - 1; i >= 0; i-- {
+		data = map[string]any{m.path[i]: data}
+	}
+
+	return json.Marshal(data)
+}
+
+// LoadMapping reads a JSON file with a common.MqttConfig. Missing entries keep
+// the values already present in config.
+func LoadMapping(path string, config *common.MqttConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, config)
+}
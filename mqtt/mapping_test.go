@@ -0,0 +1,113 @@
+package mqtt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestDefaultMapping(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "pv1"
+
+	production, err := newMapping(config, config.Mqtt.Production)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if production.topic != "pv1/production" {
+		t.Errorf("Wrong topic: %s", production.topic)
+	}
+
+	if value, err := production.decode([]byte(`{ "production": 12345678 }`)); err != nil || value != 12345678 {
+		t.Errorf("Wrong value: %f, %v", value, err)
+	}
+
+	chargingSetPoint, err := newMapping(config, config.Mqtt.ChargingSetPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload, err := chargingSetPoint.encode(1500); err != nil || string(payload) != `{"chargingSetPoint":1500}` {
+		t.Errorf("Wrong payload: %s, %v", payload, err)
+	}
+
+	productionLimit, err := newMapping(config, config.Mqtt.ProductionLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload, err := productionLimit.encodeNull(); err != nil || string(payload) != `{"productionLimit":null}` {
+		t.Errorf("Wrong payload of a lifted limit: %s, %v", payload, err)
+	}
+}
+
+func TestVendorMapping(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "pv1"
+	config.SensorId = "inverter7"
+
+	m, err := newMapping(config, common.PayloadMapping{Topic: "site/{{.EnergyCommunityId}}/{{.SensorId}}/ac", Path: "data.phases.1.power", Unit: "kW"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.topic != "site/energyCommunity/inverter7/ac" {
+		t.Errorf("Wrong topic: %s", m.topic)
+	}
+
+	value, err := m.decode([]byte(`{"data": {"phases": [{"power": "1.0"}, {"power": "2.5"}]}}`))
+	if err != nil || value != 2500 {
+		t.Errorf("Wrong value: %f, %v", value, err)
+	}
+
+	if _, err := m.decode([]byte(`{"data": {"phases": []}}`)); err == nil {
+		t.Errorf("Missing value not detected")
+	}
+
+	m, err = newMapping(config, common.PayloadMapping{Topic: "{{.Id}}/setpoint", Path: "", Scale: 0.1, Unit: "kW", AsString: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if payload, err := m.encode(2500); err != nil || string(payload) != `"25"` {
+		t.Errorf("Wrong payload: %s, %v", payload, err)
+	}
+
+	if value, err := m.decode([]byte(` 25 `)); err != nil || value != 2500 {
+		t.Errorf("Wrong plain text value: %f, %v", value, err)
+	}
+}
+
+func TestInvalidMapping(t *testing.T) {
+	config := common.NewConfig()
+
+	if _, err := newMapping(config, common.PayloadMapping{Topic: "{{.Unknown}}/production"}); err == nil {
+		t.Errorf("Unknown template field not detected")
+	}
+
+	if _, err := newMapping(config, common.PayloadMapping{Topic: "production", Unit: "hp"}); err == nil {
+		t.Errorf("Unknown unit not detected")
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"Production": {"Topic": "{{.SensorId}}/pv", "Unit": "kW"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := common.NewConfig().Mqtt
+	if err := LoadMapping(path, &config); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Production.Topic != "{{.SensorId}}/pv" || config.Production.Unit != "kW" || config.Production.Path != "production" {
+		t.Errorf("Wrong production mapping: %+v", config.Production)
+	}
+	if config.ChargingSetPoint.Topic != "{{.Id}}/chargingSetPoint" {
+		t.Errorf("Charging set point mapping changed: %+v", config.ChargingSetPoint)
+	}
+}
@@ -0,0 +1,122 @@
+package mqtt
+
+import (
+	"slices"
+	"sync"
+)
+
+// Metrics counts the messages of the outbound queue.
+type Metrics struct {
+	// Queued messages wait for the connection to the broker
+	Queued int
+	// Dropped messages were replaced by a newer message for the same topic or
+	// did not fit into the queue
+	Dropped uint64
+	// Replayed messages were published from the queue after a reconnect
+	Replayed uint64
+}
+
+type outboxMessage struct {
+	topic   string
+	payload []byte
+	qos     byte
+}
+
+// outbox buffers messages while the broker is not reachable. Only the latest
+// message per topic is kept, the oldest topic is dropped if the queue is full.
+// A size of 0 or less disables queueing.
+type outbox struct {
+	size     int
+	mu       sync.Mutex
+	messages map[string]outboxMessage
+	// topics of the messages, oldest first
+	order    []string
+	dropped  uint64
+	replayed uint64
+}
+
+func newOutbox(size int) *outbox {
+	return &outbox{size: size, messages: make(map[string]outboxMessage)}
+}
+
+// add reports whether the message was queued.
+func (o *outbox) add(message outboxMessage) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.size <= 0 {
+		o.dropped++
+		return false
+	}
+
+	if _, ok := o.messages[message.topic]; ok {
+		o.dropped++
+		o.order = slices.DeleteFunc(o.order, func(topic string) bool { return topic == message.topic })
+	} else if len(o.order) >= o.size {
+		delete(o.messages, o.order[0])
+		o.order = o.order[1:]
+		o.dropped++
+	}
+
+	o.messages[message.topic] = message
+	o.order = append(o.order, message.topic)
+	return true
+}
+
+// requeue puts a message which could not be replayed back to the front of the
+// queue.
+func (o *outbox) requeue(message outboxMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.messages[message.topic]; ok {
+		return
+	}
+	if len(o.order) >= o.size {
+		o.dropped++
+		return
+	}
+
+	o.messages[message.topic] = message
+	o.order = append([]string{message.topic}, o.order...)
+}
+
+// remove drops the queued message of a topic after a newer message was
+// published.
+func (o *outbox) remove(topic string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.messages[topic]; ok {
+		delete(o.messages, topic)
+		o.order = slices.DeleteFunc(o.order, func(t string) bool { return t == topic })
+		o.dropped++
+	}
+}
+
+func (o *outbox) pop() (outboxMessage, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.order) == 0 {
+		return outboxMessage{}, false
+	}
+
+	message := o.messages[o.order[0]]
+	delete(o.messages, o.order[0])
+	o.order = o.order[1:]
+
+	return message, true
+}
+
+func (o *outbox) markReplayed() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.replayed++
+}
+
+func (o *outbox) metrics() Metrics {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return Metrics{Queued: len(o.order), Dropped: o.dropped, Replayed: o.replayed}
+}
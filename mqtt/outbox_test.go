@@ -0,0 +1,70 @@
+package mqtt
+
+import "testing"
+
+func TestOutboxCoalesces(t *testing.T) {
+	o := newOutbox(2)
+
+	o.add(outboxMessage{topic: "a", payload: []byte("1")})
+	o.add(outboxMessage{topic: "b", payload: []byte("2")})
+	o.add(outboxMessage{topic: "a", payload: []byte("3")})
+
+	if metrics := o.metrics(); metrics.Queued != 2 || metrics.Dropped != 1 {
+		t.Errorf("Wrong metrics: %+v", metrics)
+	}
+
+	// the replaced message of a is queued after b
+	if message, _ := o.pop(); message.topic != "b" {
+		t.Errorf("Wrong order: %s", message.topic)
+	}
+	if message, _ := o.pop(); message.topic != "a" || string(message.payload) != "3" {
+		t.Errorf("Latest message not kept: %+v", message)
+	}
+	if _, ok := o.pop(); ok {
+		t.Errorf("Queue not empty")
+	}
+}
+
+func TestOutboxBounded(t *testing.T) {
+	o := newOutbox(2)
+
+	o.add(outboxMessage{topic: "a"})
+	o.add(outboxMessage{topic: "b"})
+	o.add(outboxMessage{topic: "c"})
+
+	if metrics := o.metrics(); metrics.Queued != 2 || metrics.Dropped != 1 {
+		t.Errorf("Wrong metrics: %+v", metrics)
+	}
+	if message, _ := o.pop(); message.topic != "b" {
+		t.Errorf("Oldest topic not dropped: %s", message.topic)
+	}
+
+	// a message which could not be replayed is sent first on the next
+	// connection
+	o.requeue(outboxMessage{topic: "b"})
+	if message, _ := o.pop(); message.topic != "b" {
+		t.Errorf("Requeued message not first: %s", message.topic)
+	}
+
+	o.markReplayed()
+	o.remove("c")
+	if metrics := o.metrics(); metrics.Queued != 0 || metrics.Replayed != 1 || metrics.Dropped != 2 {
+		t.Errorf("Wrong metrics: %+v", metrics)
+	}
+}
+
+func TestOutboxDisabled(t *testing.T) {
+	o := newOutbox(0)
+
+	if o.add(outboxMessage{topic: "a"}) {
+		t.Errorf("Message queued with queueing disabled")
+	}
+	o.requeue(outboxMessage{topic: "a"})
+
+	if _, ok := o.pop(); ok {
+		t.Errorf("Queue not empty")
+	}
+	if metrics := o.metrics(); metrics.Queued != 0 || metrics.Dropped != 2 {
+		t.Errorf("Wrong metrics: %+v", metrics)
+	}
+}
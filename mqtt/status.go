@@ -0,0 +1,42 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	STATUS_ONLINE  = "online"
+	STATUS_OFFLINE = "offline"
+
+	ROLE_LEADER   = "leader"
+	ROLE_FOLLOWER = "follower"
+
+	REGISTRATION_REGISTERED   = "registered"
+	REGISTRATION_UNREGISTERED = "unregistered"
+)
+
+// Status is published retained on the status topic whenever it changes. The
+// broker publishes an offline status as last will if the connection of the
+// node is lost.
+type Status struct {
+	State        string
+	Role         string
+	Registration string
+	Timestamp    time.Time
+}
+
+func newStatus() Status {
+	return Status{State: STATUS_ONLINE, Role: ROLE_FOLLOWER, Registration: REGISTRATION_UNREGISTERED}
+}
+
+func (s Status) offline() Status {
+	s.State = STATUS_OFFLINE
+	s.Role = ROLE_FOLLOWER
+	return s
+}
+
+func (s Status) payload() []byte {
+	data, _ := json.Marshal(s)
+	return data
+}
@@ -0,0 +1,37 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+func TestStatusPayload(t *testing.T) {
+	status := newStatus()
+	status.Role = ROLE_LEADER
+	status.Registration = REGISTRATION_REGISTERED
+
+	var decoded Status
+	if err := json.Unmarshal(status.offline().payload(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.State != STATUS_OFFLINE || decoded.Role != ROLE_FOLLOWER || decoded.Registration != REGISTRATION_REGISTERED {
+		t.Errorf("Wrong offline status: %+v", decoded)
+	}
+}
+
+func TestStatusTopic(t *testing.T) {
+	config := common.NewConfig()
+	config.Id = "node1"
+
+	topic, err := resolveTopic(config, config.Mqtt.StatusTopic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if topic != "node1/status" {
+		t.Errorf("Wrong status topic: %s", topic)
+	}
+}
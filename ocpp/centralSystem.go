@@ -0,0 +1,485 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/gorilla/websocket"
+)
+
+const PROTOCOL = "ocpp1.6"
+
+const (
+	measurandEnergy = "Energy.Active.Import.Register"
+	measurandPower  = "Power.Active.Import"
+)
+
+// connector states of a StatusNotification in which a vehicle is plugged in
+var pluggedStates = []string{"Preparing", "Charging", "SuspendedEV", "SuspendedEVSE", "Finishing"}
+
+var unitFactors = map[string]float64{
+	"":    1,
+	"W":   1,
+	"kW":  1000,
+	"Wh":  1,
+	"kWh": 1000,
+}
+
+var errNotConnected = errors.New("no charge point connected")
+
+// CentralSystem is an OCPP 1.6J central system for a single charge point. It
+// reports the status of the charge point and translates charging set points
+// into TxProfile charging profiles.
+type CentralSystem struct {
+	config   common.OcppConfig
+	server   *http.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	chargePointId string
+	pending       map[string]chan frame
+	nextCallId    uint64
+
+	nextTransactionId int
+	transactionId     *int
+	meterStart        float64
+	// setPoint is applied when a transaction starts, appliedSetPoint is the
+	// limit accepted by the charge point for the current transaction
+	setPoint        *float64
+	appliedSetPoint *float64
+
+	status        common.ChargerStatus
+	statusChannel chan common.ChargerStatus
+
+	writeMu sync.Mutex
+}
+
+func NewCentralSystem(config common.OcppConfig) *CentralSystem {
+	cs := CentralSystem{
+		config:            config,
+		upgrader:          websocket.Upgrader{Subprotocols: []string{PROTOCOL}},
+		pending:           make(map[string]chan frame),
+		nextTransactionId: 1,
+		statusChannel:     make(chan common.ChargerStatus, 1),
+	}
+	cs.server = &http.Server{Addr: config.ListenAddress, Handler: &cs}
+
+	return &cs
+}
+
+// Open starts the WebSocket server, charge points connect to
+// ws://<ListenAddress>/<charge point id>.
+func (cs *CentralSystem) Open() error {
+	listener, err := net.Listen("tcp", cs.config.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := cs.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("ocpp - server stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+func (cs *CentralSystem) Close() {
+	cs.server.Close()
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.conn != nil {
+		cs.conn.Close()
+	}
+}
+
+func (cs *CentralSystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := cs.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("ocpp - could not upgrade connection: %s", err)
+		return
+	}
+
+	if conn.Subprotocol() != PROTOCOL {
+		log.Printf("ocpp - charge point did not request subprotocol %s", PROTOCOL)
+		conn.Close()
+		return
+	}
+
+	chargePointId := path.Base(r.URL.Path)
+
+	cs.mu.Lock()
+	if cs.conn != nil {
+		log.Printf("ocpp - replacing connection of charge point %s", cs.chargePointId)
+		cs.conn.Close()
+	}
+	cs.conn = conn
+	cs.chargePointId = chargePointId
+	cs.mu.Unlock()
+
+	log.Printf("ocpp - charge point %s connected", chargePointId)
+	cs.read(conn)
+}
+
+func (cs *CentralSystem) read(conn *websocket.Conn) {
+	defer func() {
+		cs.mu.Lock()
+		if cs.conn == conn {
+			cs.conn = nil
+		}
+		cs.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("ocpp - charge point disconnected: %s", err)
+			return
+		}
+
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			log.Printf("ocpp - could not unmarshal message: %s", err)
+			continue
+		}
+
+		switch f.messageType {
+		case callType:
+			response, after := cs.handleCall(f)
+			cs.write(conn, response)
+			// after may call the charge point, which is answered through
+			// this loop
+			if after != nil {
+				go after()
+			}
+		case callResultType, callErrorType:
+			cs.mu.Lock()
+			resultChannel, ok := cs.pending[f.id]
+			delete(cs.pending, f.id)
+			cs.mu.Unlock()
+
+			if ok {
+				resultChannel <- f
+			}
+		}
+	}
+}
+
+func (cs *CentralSystem) write(conn *websocket.Conn, f frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	cs.writeMu.Lock()
+	defer cs.writeMu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// call sends a request to the charge point and waits for its response.
+func (cs *CentralSystem) call(ctx context.Context, action string, request any, response any) error {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	conn := cs.conn
+	if conn == nil {
+		cs.mu.Unlock()
+		return errNotConnected
+	}
+	cs.nextCallId++
+	id := strconv.FormatUint(cs.nextCallId, 10)
+	resultChannel := make(chan frame, 1)
+	cs.pending[id] = resultChannel
+	cs.mu.Unlock()
+
+	defer func() {
+		cs.mu.Lock()
+		delete(cs.pending, id)
+		cs.mu.Unlock()
+	}()
+
+	if err := cs.write(conn, frame{messageType: callType, id: id, action: action, payload: payload}); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.CallTimeout)
+	defer cancel()
+
+	select {
+	case result := <-resultChannel:
+		if result.messageType == callErrorType {
+			return fmt.Errorf("%s failed: %s %s", action, result.errorCode, result.description)
+		}
+		return json.Unmarshal(result.payload, response)
+	case <-ctx.Done():
+		return fmt.Errorf("%s failed: %w", action, ctx.Err())
+	}
+}
+
+// handleCall returns the response to a request of the charge point and an
+// optional function which has to run after the response is sent.
+func (cs *CentralSystem) handleCall(f frame) (frame, func()) {
+	response, after, err := cs.handleRequest(f.action, f.payload)
+	if err != nil {
+		errorCode := errorFormationViolation
+		if errors.Is(err, errUnknownAction) {
+			errorCode = errorNotImplemented
+		}
+		return frame{messageType: callErrorType, id: f.id, errorCode: errorCode, description: err.Error()}, nil
+	}
+
+	payload, _ := json.Marshal(response)
+	return frame{messageType: callResultType, id: f.id, payload: payload}, after
+}
+
+var errUnknownAction = errors.New("unknown action")
+
+func (cs *CentralSystem) handleRequest(action string, payload json.RawMessage) (any, func(), error) {
+	switch action {
+	case "BootNotification":
+		var request bootNotificationRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, nil, err
+		}
+		log.Printf("ocpp - boot notification of %s %s (firmware %s)", request.ChargePointVendor, request.ChargePointModel, request.FirmwareVersion)
+		return bootNotificationResponse{Status: "Accepted", CurrentTime: time.Now().UTC(), Interval: int(cs.config.HeartbeatInterval.Seconds())}, nil, nil
+	case "Heartbeat":
+		return heartbeatResponse{CurrentTime: time.Now().UTC()}, nil, nil
+	case "StatusNotification":
+		var request statusNotificationRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, nil, err
+		}
+		cs.handleStatusNotification(request)
+		return struct{}{}, nil, nil
+	case "MeterValues":
+		var request meterValuesRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, nil, err
+		}
+		cs.handleMeterValues(request)
+		return struct{}{}, nil, nil
+	case "Authorize":
+		return authorizeResponse{IdTagInfo: idTagInfo{Status: "Accepted"}}, nil, nil
+	case "StartTransaction":
+		var request startTransactionRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, nil, err
+		}
+		response, after := cs.handleStartTransaction(request)
+		return response, after, nil
+	case "StopTransaction":
+		var request stopTransactionRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, nil, err
+		}
+		cs.handleStopTransaction(request)
+		return stopTransactionResponse{IdTagInfo: idTagInfo{Status: "Accepted"}}, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("%w %s", errUnknownAction, action)
+	}
+}
+
+func (cs *CentralSystem) handleStatusNotification(request statusNotificationRequest) {
+	// connector 0 reports errors of the whole charge point
+	if request.ConnectorId != 0 && request.ConnectorId != cs.config.ConnectorId {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if request.ConnectorId != 0 {
+		cs.status.Plugged = slices.Contains(pluggedStates, request.Status)
+	}
+
+	cs.status.ErrorCodes = nil
+	if request.ErrorCode != "" && request.ErrorCode != "NoError" {
+		cs.status.ErrorCodes = append(cs.status.ErrorCodes, request.ErrorCode)
+		if request.VendorErrorCode != "" {
+			cs.status.ErrorCodes = append(cs.status.ErrorCodes, request.VendorErrorCode)
+		}
+	}
+
+	cs.publishStatus()
+}
+
+func (cs *CentralSystem) handleMeterValues(request meterValuesRequest) {
+	if request.ConnectorId != cs.config.ConnectorId || len(request.MeterValue) == 0 {
+		return
+	}
+
+	// totals are preferred over the sum of the phases
+	totals := make(map[string]float64)
+	phases := make(map[string]float64)
+	for _, sampled := range request.MeterValue[len(request.MeterValue)-1].SampledValue {
+		value, err := strconv.ParseFloat(sampled.Value, 64)
+		if err != nil {
+			log.Printf("ocpp - invalid sampled value %q", sampled.Value)
+			continue
+		}
+		factor, ok := unitFactors[sampled.Unit]
+		if !ok {
+			continue
+		}
+
+		measurand := sampled.Measurand
+		if measurand == "" {
+			measurand = measurandEnergy
+		}
+		if sampled.Phase == "" {
+			totals[measurand] = value * factor
+		} else {
+			phases[measurand] += value * factor
+		}
+	}
+
+	measurement := func(measurand string) (float64, bool) {
+		if value, ok := totals[measurand]; ok {
+			return value, true
+		}
+		value, ok := phases[measurand]
+		return value, ok
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if power, ok := measurement(measurandPower); ok {
+		cs.status.ChargingPower = power
+	}
+	if energy, ok := measurement(measurandEnergy); ok && cs.transactionId != nil {
+		cs.status.SessionEnergy = energy - cs.meterStart
+	}
+
+	cs.publishStatus()
+}
+
+// handleStartTransaction returns a function applying the pending set point,
+// the charge point knows the transaction once the response is sent.
+func (cs *CentralSystem) handleStartTransaction(request startTransactionRequest) (startTransactionResponse, func()) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	transactionId := cs.nextTransactionId
+	cs.nextTransactionId++
+
+	var after func()
+	if request.ConnectorId == cs.config.ConnectorId {
+		cs.transactionId = &transactionId
+		cs.meterStart = float64(request.MeterStart)
+		cs.appliedSetPoint = nil
+		cs.status.SessionEnergy = 0
+		cs.publishStatus()
+
+		if cs.setPoint != nil {
+			setPoint := *cs.setPoint
+			after = func() {
+				if err := cs.PublishChargingSetPoint(context.Background(), setPoint); err != nil {
+					log.Printf("ocpp - could not apply charging set point: %s", err)
+				}
+			}
+		}
+	}
+
+	return startTransactionResponse{IdTagInfo: idTagInfo{Status: "Accepted"}, TransactionId: transactionId}, after
+}
+
+func (cs *CentralSystem) handleStopTransaction(request stopTransactionRequest) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.transactionId == nil || *cs.transactionId != request.TransactionId {
+		return
+	}
+
+	cs.transactionId = nil
+	cs.appliedSetPoint = nil
+	cs.status.ChargingPower = 0
+	cs.status.SessionEnergy = float64(request.MeterStop) - cs.meterStart
+	cs.publishStatus()
+}
+
+// publishStatus keeps only the latest status if the channel is not read in
+// time. cs.mu has to be held.
+func (cs *CentralSystem) publishStatus() {
+	cs.status.Timestamp = time.Now()
+	status := cs.status
+	status.ErrorCodes = slices.Clone(cs.status.ErrorCodes)
+
+	select {
+	case <-cs.statusChannel:
+	default:
+	}
+	cs.statusChannel <- status
+}
+
+// SubscribeToChargerStatus reports the status of the charge point. Only the
+// latest status is kept if the channel is not read in time.
+func (cs *CentralSystem) SubscribeToChargerStatus(ctx context.Context) (<-chan common.ChargerStatus, error) {
+	return cs.statusChannel, nil
+}
+
+// PublishChargingSetPoint limits the current transaction to setPoint W with a
+// TxProfile. Without a transaction the set point is applied as soon as a
+// transaction starts. A limit already accepted for the transaction is not sent
+// again.
+func (cs *CentralSystem) PublishChargingSetPoint(ctx context.Context, setPoint float64) error {
+	cs.mu.Lock()
+	cs.setPoint = &setPoint
+	transactionId := cs.transactionId
+	applied := cs.appliedSetPoint != nil && *cs.appliedSetPoint == setPoint
+	cs.mu.Unlock()
+
+	if transactionId == nil || applied {
+		return nil
+	}
+
+	request := setChargingProfileRequest{
+		ConnectorId: cs.config.ConnectorId,
+		CsChargingProfiles: chargingProfile{
+			ChargingProfileId:      1,
+			TransactionId:          transactionId,
+			StackLevel:             0,
+			ChargingProfilePurpose: "TxProfile",
+			ChargingProfileKind:    "Relative",
+			ChargingSchedule: chargingSchedule{
+				ChargingRateUnit:       "W",
+				ChargingSchedulePeriod: []chargingSchedulePeriod{{StartPeriod: 0, Limit: setPoint}},
+			},
+		},
+	}
+
+	var response setChargingProfileResponse
+	if err := cs.call(ctx, "SetChargingProfile", request, &response); err != nil {
+		return err
+	}
+	if response.Status != "Accepted" {
+		return fmt.Errorf("charging profile %s", response.Status)
+	}
+
+	cs.mu.Lock()
+	if cs.transactionId != nil && *cs.transactionId == *transactionId {
+		cs.appliedSetPoint = &setPoint
+	}
+	cs.mu.Unlock()
+
+	return nil
+}
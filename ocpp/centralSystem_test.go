@@ -0,0 +1,181 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/gorilla/websocket"
+)
+
+// testChargePoint simulates a charge point which accepts the charging
+// profiles of its transactions and forwards them to profiles. Profiles for
+// unknown transactions are rejected.
+type testChargePoint struct {
+	t            *testing.T
+	conn         *websocket.Conn
+	writeMu      sync.Mutex
+	results      chan json.RawMessage
+	profiles     chan setChargingProfileRequest
+	transactions map[int]bool
+}
+
+func newTestChargePoint(t *testing.T, url string) *testChargePoint {
+	dialer := websocket.Dialer{Subprotocols: []string{PROTOCOL}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/cp1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp := testChargePoint{t: t, conn: conn, results: make(chan json.RawMessage, 10), profiles: make(chan setChargingProfileRequest, 10), transactions: make(map[int]bool)}
+
+	go func() {
+		for {
+			var f frame
+			if err := conn.ReadJSON(&f); err != nil {
+				return
+			}
+
+			switch f.messageType {
+			case callResultType:
+				// the call id is the action
+				if f.id == "StartTransaction" {
+					var response startTransactionResponse
+					json.Unmarshal(f.payload, &response)
+					cp.transactions[response.TransactionId] = true
+				}
+				cp.results <- f.payload
+			case callErrorType:
+				cp.results <- json.RawMessage(f.errorCode)
+			case callType:
+				var request setChargingProfileRequest
+				json.Unmarshal(f.payload, &request)
+				if id := request.CsChargingProfiles.TransactionId; id == nil || !cp.transactions[*id] {
+					cp.write(frame{messageType: callResultType, id: f.id, payload: json.RawMessage(`{"status":"Rejected"}`)})
+					continue
+				}
+				cp.profiles <- request
+				cp.write(frame{messageType: callResultType, id: f.id, payload: json.RawMessage(`{"status":"Accepted"}`)})
+			}
+		}
+	}()
+
+	return &cp
+}
+
+func (cp *testChargePoint) write(f frame) error {
+	cp.writeMu.Lock()
+	defer cp.writeMu.Unlock()
+	return cp.conn.WriteJSON(f)
+}
+
+func (cp *testChargePoint) call(action string, payload string) json.RawMessage {
+	if err := cp.write(frame{messageType: callType, id: action, action: action, payload: json.RawMessage(payload)}); err != nil {
+		cp.t.Fatal(err)
+	}
+
+	select {
+	case result := <-cp.results:
+		return result
+	case <-time.After(time.Second):
+		cp.t.Fatalf("No response to %s", action)
+		return nil
+	}
+}
+
+func latestStatus(t *testing.T, statusChannel <-chan common.ChargerStatus) common.ChargerStatus {
+	select {
+	case status := <-statusChannel:
+		return status
+	case <-time.After(time.Second):
+		t.Fatalf("No status published")
+		return common.ChargerStatus{}
+	}
+}
+
+func TestCentralSystem(t *testing.T) {
+	config := common.NewConfig().Ocpp
+	cs := NewCentralSystem(config)
+	server := httptest.NewServer(cs)
+	defer server.Close()
+
+	statusChannel, _ := cs.SubscribeToChargerStatus(context.Background())
+	cp := newTestChargePoint(t, server.URL)
+	defer cp.conn.Close()
+
+	var boot bootNotificationResponse
+	json.Unmarshal(cp.call("BootNotification", `{"chargePointVendor":"vendor","chargePointModel":"model"}`), &boot)
+	if boot.Status != "Accepted" || boot.Interval != 60 {
+		t.Errorf("Wrong boot notification response: %+v", boot)
+	}
+
+	cp.call("StatusNotification", `{"connectorId":1,"errorCode":"NoError","status":"Preparing"}`)
+	if status := latestStatus(t, statusChannel); !status.Plugged || len(status.ErrorCodes) != 0 {
+		t.Errorf("Wrong status after status notification: %+v", status)
+	}
+
+	// no transaction yet, the set point is applied when it starts
+	if err := cs.PublishChargingSetPoint(context.Background(), 7400); err != nil {
+		t.Fatal(err)
+	}
+
+	var start startTransactionResponse
+	json.Unmarshal(cp.call("StartTransaction", `{"connectorId":1,"idTag":"tag","meterStart":1000,"timestamp":"2024-01-01T12:00:00Z"}`), &start)
+	latestStatus(t, statusChannel)
+
+	select {
+	case profile := <-cp.profiles:
+		p := profile.CsChargingProfiles
+		if profile.ConnectorId != 1 || p.ChargingProfilePurpose != "TxProfile" || p.TransactionId == nil || *p.TransactionId != start.TransactionId {
+			t.Errorf("Wrong charging profile: %+v", profile)
+		}
+		if p.ChargingSchedule.ChargingRateUnit != "W" || p.ChargingSchedule.ChargingSchedulePeriod[0].Limit != 7400 {
+			t.Errorf("Wrong charging schedule: %+v", p.ChargingSchedule)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No charging profile sent")
+	}
+
+	cp.call("MeterValues", `{"connectorId":1,"transactionId":1,"meterValue":[{"timestamp":"2024-01-01T12:01:00Z","sampledValue":[
+		{"value":"2.5","measurand":"Energy.Active.Import.Register","unit":"kWh"},
+		{"value":"2400","measurand":"Power.Active.Import","phase":"L1","unit":"W"},
+		{"value":"2400","measurand":"Power.Active.Import","phase":"L2","unit":"W"},
+		{"value":"2400","measurand":"Power.Active.Import","phase":"L3","unit":"W"}]}]}`)
+	if status := latestStatus(t, statusChannel); status.ChargingPower != 7200 || status.SessionEnergy != 1500 {
+		t.Errorf("Wrong status after meter values: %+v", status)
+	}
+
+	if err := cs.PublishChargingSetPoint(context.Background(), 3700); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case profile := <-cp.profiles:
+		if limit := profile.CsChargingProfiles.ChargingSchedule.ChargingSchedulePeriod[0].Limit; limit != 3700 {
+			t.Errorf("Wrong limit: %f", limit)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Changed set point not sent")
+	}
+
+	// an accepted limit is not sent again
+	if err := cs.PublishChargingSetPoint(context.Background(), 3700); err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.profiles) != 0 {
+		t.Errorf("Accepted limit sent again")
+	}
+
+	cp.call("StatusNotification", `{"connectorId":1,"errorCode":"GroundFailure","status":"Faulted","vendorErrorCode":"E42"}`)
+	if status := latestStatus(t, statusChannel); status.Plugged || len(status.ErrorCodes) != 2 {
+		t.Errorf("Wrong status after fault: %+v", status)
+	}
+
+	if result := cp.call("DataTransfer", `{"vendorId":"vendor"}`); string(result) != errorNotImplemented {
+		t.Errorf("Unknown action not rejected: %s", result)
+	}
+}
@@ -0,0 +1,183 @@
+package ocpp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// OCPP-J message types
+const (
+	callType       = 2
+	callResultType = 3
+	callErrorType  = 4
+)
+
+// OCPP-J error codes
+const (
+	errorNotImplemented     = "NotImplemented"
+	errorFormationViolation = "FormationViolation"
+)
+
+// frame is an OCPP-J call, call result or call error.
+type frame struct {
+	messageType int
+	id          string
+	action      string
+	payload     json.RawMessage
+	errorCode   string
+	description string
+}
+
+func (f *frame) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid message %s", data)
+	}
+
+	if err := json.Unmarshal(fields[0], &f.messageType); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(fields[1], &f.id); err != nil {
+		return err
+	}
+
+	switch f.messageType {
+	case callType:
+		if len(fields) != 4 {
+			return fmt.Errorf("invalid call %s", data)
+		}
+		if err := json.Unmarshal(fields[2], &f.action); err != nil {
+			return err
+		}
+		f.payload = fields[3]
+	case callResultType:
+		f.payload = fields[2]
+	case callErrorType:
+		if len(fields) < 4 {
+			return fmt.Errorf("invalid call error %s", data)
+		}
+		if err := json.Unmarshal(fields[2], &f.errorCode); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(fields[3], &f.description); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown message type %d", f.messageType)
+	}
+
+	return nil
+}
+
+func (f frame) MarshalJSON() ([]byte, error) {
+	switch f.messageType {
+	case callType:
+		return json.Marshal([]any{f.messageType, f.id, f.action, f.payload})
+	case callResultType:
+		return json.Marshal([]any{f.messageType, f.id, f.payload})
+	default:
+		return json.Marshal([]any{f.messageType, f.id, f.errorCode, f.description, struct{}{}})
+	}
+}
+
+type bootNotificationRequest struct {
+	ChargePointVendor       string `json:"chargePointVendor"`
+	ChargePointModel        string `json:"chargePointModel"`
+	ChargePointSerialNumber string `json:"chargePointSerialNumber,omitempty"`
+	FirmwareVersion         string `json:"firmwareVersion,omitempty"`
+}
+
+type bootNotificationResponse struct {
+	Status      string    `json:"status"`
+	CurrentTime time.Time `json:"currentTime"`
+	Interval    int       `json:"interval"`
+}
+
+type heartbeatResponse struct {
+	CurrentTime time.Time `json:"currentTime"`
+}
+
+type statusNotificationRequest struct {
+	ConnectorId     int    `json:"connectorId"`
+	ErrorCode       string `json:"errorCode"`
+	Status          string `json:"status"`
+	VendorErrorCode string `json:"vendorErrorCode,omitempty"`
+}
+
+type sampledValue struct {
+	Value     string `json:"value"`
+	Measurand string `json:"measurand,omitempty"`
+	Phase     string `json:"phase,omitempty"`
+	Unit      string `json:"unit,omitempty"`
+}
+
+type meterValue struct {
+	Timestamp    time.Time      `json:"timestamp"`
+	SampledValue []sampledValue `json:"sampledValue"`
+}
+
+type meterValuesRequest struct {
+	ConnectorId   int          `json:"connectorId"`
+	TransactionId *int         `json:"transactionId,omitempty"`
+	MeterValue    []meterValue `json:"meterValue"`
+}
+
+type idTagInfo struct {
+	Status string `json:"status"`
+}
+
+type authorizeResponse struct {
+	IdTagInfo idTagInfo `json:"idTagInfo"`
+}
+
+type startTransactionRequest struct {
+	ConnectorId int    `json:"connectorId"`
+	IdTag       string `json:"idTag"`
+	MeterStart  int    `json:"meterStart"`
+}
+
+type startTransactionResponse struct {
+	IdTagInfo     idTagInfo `json:"idTagInfo"`
+	TransactionId int       `json:"transactionId"`
+}
+
+type stopTransactionRequest struct {
+	TransactionId int `json:"transactionId"`
+	MeterStop     int `json:"meterStop"`
+}
+
+type stopTransactionResponse struct {
+	IdTagInfo idTagInfo `json:"idTagInfo"`
+}
+
+type chargingSchedulePeriod struct {
+	StartPeriod int     `json:"startPeriod"`
+	Limit       float64 `json:"limit"`
+}
+
+type chargingSchedule struct {
+	ChargingRateUnit       string                   `json:"chargingRateUnit"`
+	ChargingSchedulePeriod []chargingSchedulePeriod `json:"chargingSchedulePeriod"`
+}
+
+type chargingProfile struct {
+	ChargingProfileId      int              `json:"chargingProfileId"`
+	TransactionId          *int             `json:"transactionId,omitempty"`
+	StackLevel             int              `json:"stackLevel"`
+	ChargingProfilePurpose string           `json:"chargingProfilePurpose"`
+	ChargingProfileKind    string           `json:"chargingProfileKind"`
+	ChargingSchedule       chargingSchedule `json:"chargingSchedule"`
+}
+
+type setChargingProfileRequest struct {
+	ConnectorId        int             `json:"connectorId"`
+	CsChargingProfiles chargingProfile `json:"csChargingProfiles"`
+}
+
+type setChargingProfileResponse struct {
+	Status string `json:"status"`
+}
@@ -0,0 +1,159 @@
+package registration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/coatyio/dda/services/com/api"
+)
+
+// RejectedError is returned by Register if the leader refuses the node.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("registration rejected: %s", e.Reason)
+}
+
+// connector is the part of dda.Connector used for the registration.
+type connector interface {
+	RegisterNode(registration common.DdaRegisterMessage) error
+	DeregisterNode(nodeId string, sensorId string) error
+	RenewLease(nodeId string, sensorId string, timeout time.Duration) error
+	SubscribeEvent(ctx context.Context, filter api.SubscriptionFilter) (<-chan api.Event, error)
+}
+
+// Client registers a node at the leader of the energy community and
+// deregisters it on shutdown. Requests are repeated with exponential backoff
+// until the leader answers or the context is done.
+type Client struct {
+	connector    connector
+	config       common.RegistrationConfig
+	registration common.DdaRegisterMessage
+}
+
+func NewClient(config common.RegistrationConfig, connector connector, registration common.DdaRegisterMessage) *Client {
+	return &Client{config: config, connector: connector, registration: registration}
+}
+
+// Register blocks until the leader accepted the registration. It returns a
+// *RejectedError if the leader refused it, or the error of ctx.
+func (c *Client) Register(ctx context.Context) error {
+	return c.request(ctx, common.OPERATION_REGISTER, func() error {
+		return c.connector.RegisterNode(c.registration)
+	})
+}
+
+// Deregister blocks until the leader acknowledged the deregistration. Use a
+// context with deadline, no leader might be reachable on shutdown.
+func (c *Client) Deregister(ctx context.Context) error {
+	return c.request(ctx, common.OPERATION_DEREGISTER, func() error {
+		return c.connector.DeregisterNode(c.registration.NodeId, c.registration.SensorId)
+	})
+}
+
+// RenewLeases renews the liveness lease of the node every config.Interval
+// until ctx is done. The node registers again if the leader rejects a renewal
+// because it does not know the node anymore, e.g. after its lease expired.
+func (c *Client) RenewLeases(ctx context.Context, config common.LeaseConfig) {
+	responses, err := c.connector.SubscribeEvent(ctx, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
+	if err != nil {
+		log.Printf("registration - could not subscribe to lease responses: %s", err)
+		return
+	}
+
+	renew := func() {
+		if err := c.connector.RenewLease(c.registration.NodeId, c.registration.SensorId, config.Timeout); err != nil {
+			log.Printf("registration - could not renew lease: %s", err)
+		}
+	}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	renew()
+	for {
+		select {
+		case <-ticker.C:
+			renew()
+		case event, ok := <-responses:
+			if !ok {
+				return
+			}
+
+			var response common.DdaRegisterResponse
+			if err := json.Unmarshal(event.Data, &response); err != nil || response.NodeId != c.registration.NodeId || response.Operation != common.OPERATION_LEASE || response.Accepted {
+				continue
+			}
+
+			log.Printf("registration - lease of node %s rejected: %s, registering again", c.registration.NodeId, response.Reason)
+			if err := c.Register(ctx); err != nil {
+				log.Printf("registration - could not register node again: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// request sends the operation until the leader answers it. Responses to other
+// operations of the node, e.g. a late answer to an earlier registration, are
+// ignored.
+func (c *Client) request(ctx context.Context, name string, send func() error) error {
+	requestCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses, err := c.connector.SubscribeEvent(requestCtx, api.SubscriptionFilter{Type: common.REGISTER_RESPONSE_EVENT})
+	if err != nil {
+		return err
+	}
+
+	backoff := c.config.RetryBase
+	for attempt := 1; ; attempt++ {
+		log.Printf("registration - trying to %s node %s (attempt %d)", name, c.registration.NodeId, attempt)
+
+		if err := send(); err != nil {
+			log.Printf("registration - could not %s node: %s", name, err)
+		}
+
+		retry := time.NewTimer(backoff)
+
+	wait:
+		for {
+			select {
+			case event, ok := <-responses:
+				if !ok {
+					retry.Stop()
+					return ctx.Err()
+				}
+
+				var response common.DdaRegisterResponse
+				if err := json.Unmarshal(event.Data, &response); err != nil || response.NodeId != c.registration.NodeId || response.Operation != name {
+					continue
+				}
+
+				retry.Stop()
+				if !response.Accepted {
+					return &RejectedError{Reason: response.Reason}
+				}
+				log.Printf("registration - %s node %s done", name, c.registration.NodeId)
+				return nil
+			case <-retry.C:
+				break wait
+			case <-ctx.Done():
+				retry.Stop()
+				return fmt.Errorf("could not %s node %s: %w", name, c.registration.NodeId, ctx.Err())
+			}
+		}
+
+		backoff *= 2
+		if backoff > c.config.RetryMax {
+			backoff = c.config.RetryMax
+		}
+	}
+}
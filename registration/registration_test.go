@@ -0,0 +1,161 @@
+package registration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+	"github.com/coatyio/dda/services/com/api"
+)
+
+// testConnector answers every request after the given number of ignored
+// attempts, or never if answerAfter is negative. Lease renewals are rejected
+// if rejectLeases is set.
+type testConnector struct {
+	mu           sync.Mutex
+	attempts     int
+	answerAfter  int
+	response     common.DdaRegisterResponse
+	rejectLeases bool
+	renewals     int
+	subscribers  []chan api.Event
+}
+
+func newTestConnector(answerAfter int, response common.DdaRegisterResponse) *testConnector {
+	return &testConnector{answerAfter: answerAfter, response: response}
+}
+
+// publish has to be called with the lock held.
+func (c *testConnector) publish(response common.DdaRegisterResponse) {
+	data, _ := json.Marshal(response)
+	for _, subscriber := range c.subscribers {
+		select {
+		case subscriber <- api.Event{Type: common.REGISTER_RESPONSE_EVENT, Data: data}:
+		default:
+		}
+	}
+}
+
+func (c *testConnector) request() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts++
+	if c.answerAfter >= 0 && c.attempts > c.answerAfter {
+		c.publish(c.response)
+	}
+	return nil
+}
+
+func (c *testConnector) RegisterNode(registration common.DdaRegisterMessage) error {
+	return c.request()
+}
+
+func (c *testConnector) DeregisterNode(nodeId string, sensorId string) error {
+	return c.request()
+}
+
+func (c *testConnector) RenewLease(nodeId string, sensorId string, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.renewals++
+	if c.rejectLeases {
+		c.rejectLeases = false
+		c.publish(common.DdaRegisterResponse{NodeId: nodeId, Operation: common.OPERATION_LEASE, Accepted: false, Reason: "not registered"})
+	}
+	return nil
+}
+
+func (c *testConnector) SubscribeEvent(ctx context.Context, filter api.SubscriptionFilter) (<-chan api.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subscriber := make(chan api.Event, 10)
+	c.subscribers = append(c.subscribers, subscriber)
+	return subscriber, nil
+}
+
+func (c *testConnector) counts() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts, c.renewals
+}
+
+var testConfig = common.RegistrationConfig{RetryBase: 10 * time.Millisecond, RetryMax: 40 * time.Millisecond, ShutdownTimeout: time.Second}
+
+func TestRegisterWithRetries(t *testing.T) {
+	connector := newTestConnector(2, common.DdaRegisterResponse{NodeId: "a", Operation: common.OPERATION_REGISTER, Accepted: true})
+	client := NewClient(testConfig, connector, common.DdaRegisterMessage{NodeId: "a"})
+
+	if err := client.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if connector.attempts != 3 {
+		t.Errorf("Wrong number of attempts: %d", connector.attempts)
+	}
+}
+
+func TestRegisterRejected(t *testing.T) {
+	connector := newTestConnector(0, common.DdaRegisterResponse{NodeId: "a", Operation: common.OPERATION_REGISTER, Accepted: false, Reason: "too old"})
+	client := NewClient(testConfig, connector, common.DdaRegisterMessage{NodeId: "a"})
+
+	var rejected *RejectedError
+	if err := client.Register(context.Background()); !errors.As(err, &rejected) || rejected.Reason != "too old" {
+		t.Errorf("Expected rejection, got %v", err)
+	}
+}
+
+func TestDeregisterDeadline(t *testing.T) {
+	connector := newTestConnector(-1, common.DdaRegisterResponse{})
+	client := NewClient(testConfig, connector, common.DdaRegisterMessage{NodeId: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := client.Deregister(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Deregistration did not stop at the deadline")
+	}
+
+	// 10, 20, 40, 40, 40 ... ms between attempts
+	if connector.attempts < 4 || connector.attempts > 8 {
+		t.Errorf("Wrong number of attempts: %d", connector.attempts)
+	}
+}
+
+func TestRegisterIgnoresOtherOperations(t *testing.T) {
+	connector := newTestConnector(0, common.DdaRegisterResponse{NodeId: "a", Operation: common.OPERATION_DEREGISTER, Accepted: true})
+	client := NewClient(testConfig, connector, common.DdaRegisterMessage{NodeId: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := client.Register(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Deregistration response accepted as registration: %v", err)
+	}
+}
+
+func TestRegisterAgainAfterRejectedLease(t *testing.T) {
+	connector := newTestConnector(0, common.DdaRegisterResponse{NodeId: "a", Operation: common.OPERATION_REGISTER, Accepted: true})
+	connector.rejectLeases = true
+	client := NewClient(testConfig, connector, common.DdaRegisterMessage{NodeId: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	client.RenewLeases(ctx, common.LeaseConfig{Interval: 20 * time.Millisecond, Timeout: 60 * time.Millisecond})
+
+	if attempts, renewals := connector.counts(); attempts != 1 || renewals < 3 {
+		t.Errorf("Wrong number of registrations or renewals: %d, %d", attempts, renewals)
+	}
+}
@@ -0,0 +1,154 @@
+package sct
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConflictReport is the result of the non-blocking check of modular
+// supervisors.
+type ConflictReport struct {
+	Nonblocking    bool
+	States         int
+	BlockingStates int
+	// Counterexample is a shortest event sequence leading to a state of the
+	// synchronous product from which no jointly marked state can be reached.
+	Counterexample []string
+}
+
+func (r ConflictReport) String() string {
+	if r.Nonblocking {
+		return fmt.Sprintf("non-blocking (%d states)", r.States)
+	}
+	return fmt.Sprintf("conflicting (%d of %d states blocking), counterexample: [%s]", r.BlockingStates, r.States, strings.Join(r.Counterexample, " "))
+}
+
+// CheckNonblocking computes the synchronous product of the given supervisors
+// and checks whether a jointly marked state can be reached from every
+// reachable state of the product.
+func CheckNonblocking(models []Model) ConflictReport {
+	automata := make([]*automaton, 0, len(models))
+	for _, model := range models {
+		a := newAutomaton(model)
+		if a.initial == -1 {
+			return ConflictReport{Nonblocking: false, Counterexample: []string{}}
+		}
+		automata = append(automata, a)
+	}
+
+	alphabet := make([]string, 0)
+	for _, a := range automata {
+		for _, e := range a.events {
+			if !slices.Contains(alphabet, e) {
+				alphabet = append(alphabet, e)
+			}
+		}
+	}
+	sort.Strings(alphabet)
+
+	type productState struct {
+		components []int
+		parent     int
+		event      string
+	}
+
+	key := func(components []int) string {
+		parts := make([]string, len(components))
+		for i, c := range components {
+			parts[i] = strconv.Itoa(c)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	initial := make([]int, len(automata))
+	for i, a := range automata {
+		initial[i] = a.initial
+	}
+
+	states := []productState{{components: initial, parent: -1}}
+	index := map[string]int{key(initial): 0}
+	predecessors := make(map[int][]int)
+
+	for current := 0; current < len(states); current++ {
+		for _, event := range alphabet {
+			next := make([]int, len(automata))
+			enabled := true
+
+			for i, a := range automata {
+				e, ok := a.eventIndex[event]
+				if !ok {
+					next[i] = states[current].components[i]
+					continue
+				}
+
+				target := a.transitions[states[current].components[i]][e]
+				if target == -1 {
+					enabled = false
+					break
+				}
+				next[i] = target
+			}
+
+			if !enabled {
+				continue
+			}
+
+			k := key(next)
+			target, ok := index[k]
+			if !ok {
+				target = len(states)
+				index[k] = target
+				states = append(states, productState{components: next, parent: current, event: event})
+			}
+			predecessors[target] = append(predecessors[target], current)
+		}
+	}
+
+	// backwards search from all jointly marked states
+	coreachable := make([]bool, len(states))
+	queue := make([]int, 0)
+	for i, s := range states {
+		marked := true
+		for c, a := range automata {
+			marked = marked && a.marked[s.components[c]]
+		}
+		if marked {
+			coreachable[i] = true
+			queue = append(queue, i)
+		}
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, predecessor := range predecessors[current] {
+			if !coreachable[predecessor] {
+				coreachable[predecessor] = true
+				queue = append(queue, predecessor)
+			}
+		}
+	}
+
+	report := ConflictReport{Nonblocking: true, States: len(states)}
+	for i := range states {
+		if coreachable[i] {
+			continue
+		}
+
+		report.BlockingStates++
+		if report.Nonblocking {
+			// states are numbered in breadth first order, so the first blocking
+			// state has a shortest path
+			report.Nonblocking = false
+			report.Counterexample = make([]string, 0)
+			for s := i; states[s].parent != -1; s = states[s].parent {
+				report.Counterexample = append([]string{states[s].event}, report.Counterexample...)
+			}
+		}
+	}
+
+	return report
+}
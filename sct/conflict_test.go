@@ -0,0 +1,61 @@
+package sct
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestCheckNonblockingResources(t *testing.T) {
+	models := make([]Model, 0)
+	for _, file := range []string{"../resources/simpleController1.xml", "../resources/simpleController2.xml"} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		models = append(models, loaded...)
+	}
+
+	if report := CheckNonblocking(models); !report.Nonblocking {
+		t.Errorf("Supervisors are conflicting: %s", report)
+	}
+}
+
+func TestCheckNonblockingConflict(t *testing.T) {
+	// the first supervisor wants a before b, the second one b before a
+	first := loadSingle(t, `{
+		"name": "first",
+		"events": [{"name": "a", "controllable": true}, {"name": "b", "controllable": true}, {"name": "c"}],
+		"states": [{"name": "0", "initial": true, "marked": true}, {"name": "1"}, {"name": "2"}],
+		"transitions": [
+			{"source": "0", "event": "c", "target": "0"},
+			{"source": "0", "event": "a", "target": "1"},
+			{"source": "1", "event": "b", "target": "0"}
+		]
+	}`)
+	second := loadSingle(t, `{
+		"name": "second",
+		"events": [{"name": "a", "controllable": true}, {"name": "b", "controllable": true}, {"name": "c"}],
+		"states": [{"name": "0", "initial": true, "marked": true}, {"name": "1"}],
+		"transitions": [
+			{"source": "0", "event": "b", "target": "1"},
+			{"source": "1", "event": "a", "target": "0"},
+			{"source": "0", "event": "c", "target": "1"}
+		]
+	}`)
+
+	report := CheckNonblocking([]Model{first, second})
+
+	if report.Nonblocking {
+		t.Fatalf("Conflict not detected: %s", report)
+	}
+
+	if !slices.Equal(report.Counterexample, []string{"c"}) {
+		t.Errorf("Wrong counterexample: %v", report.Counterexample)
+	}
+}
@@ -0,0 +1,309 @@
+package sct
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The DESTool/libFAUDES generator format (.gen) is a token stream of sections
+// like <Alphabet> ... </Alphabet> containing quoted names, numeric indices and
+// attributes like +C+ for controllable events.
+
+type desToolTokenKind int
+
+const (
+	desToolBegin desToolTokenKind = iota
+	desToolEnd
+	desToolString
+	desToolInteger
+	desToolOption
+)
+
+type desToolToken struct {
+	kind       desToolTokenKind
+	value      string
+	attributes map[string]string
+}
+
+func stripDESToolComments(content []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("%")) {
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+func tokenizeDESTool(content io.Reader) ([]desToolToken, error) {
+	r := bufio.NewReader(content)
+	tokens := make([]desToolToken, 0)
+
+	for {
+		c, _, err := r.ReadRune()
+		if err == io.EOF {
+			return tokens, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case unicode.IsSpace(c):
+			continue
+		case c == '%':
+			if _, err := r.ReadString('\n'); err != nil && err != io.EOF {
+				return nil, err
+			}
+		case c == '"':
+			value, err := r.ReadString('"')
+			if err != nil {
+				return nil, fmt.Errorf("unterminated string in DESTool generator")
+			}
+			tokens = append(tokens, desToolToken{kind: desToolString, value: strings.TrimSuffix(value, "\"")})
+		case c == '<':
+			tag, err := r.ReadString('>')
+			if err != nil {
+				return nil, fmt.Errorf("unterminated section in DESTool generator")
+			}
+			tag = strings.TrimSpace(strings.TrimSuffix(tag, ">"))
+			if strings.HasPrefix(tag, "/") {
+				tokens = append(tokens, desToolToken{kind: desToolEnd, value: strings.TrimSpace(tag[1:])})
+				continue
+			}
+			name, attributes := parseDESToolTag(tag)
+			tokens = append(tokens, desToolToken{kind: desToolBegin, value: name, attributes: attributes})
+		case c == '+':
+			value, err := r.ReadString('+')
+			if err != nil {
+				return nil, fmt.Errorf("unterminated option in DESTool generator")
+			}
+			tokens = append(tokens, desToolToken{kind: desToolOption, value: strings.TrimSuffix(value, "+")})
+		default:
+			var sb strings.Builder
+			sb.WriteRune(c)
+			for {
+				c, _, err := r.ReadRune()
+				if err != nil || unicode.IsSpace(c) {
+					break
+				}
+				if c == '"' || c == '<' || c == '+' || c == '%' {
+					r.UnreadRune()
+					break
+				}
+				sb.WriteRune(c)
+			}
+			if _, err := strconv.Atoi(sb.String()); err != nil {
+				// bare words are treated like quoted names
+				tokens = append(tokens, desToolToken{kind: desToolString, value: sb.String()})
+			} else {
+				tokens = append(tokens, desToolToken{kind: desToolInteger, value: sb.String()})
+			}
+		}
+	}
+}
+
+func parseDESToolTag(tag string) (string, map[string]string) {
+	attributes := make(map[string]string)
+	name, rest, _ := strings.Cut(tag, " ")
+	for _, field := range strings.Fields(rest) {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			attributes[key] = strings.Trim(value, "\"")
+		}
+	}
+	return name, attributes
+}
+
+func parseDESTool(content io.Reader) (*Model, error) {
+	tokens, err := tokenizeDESTool(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 || tokens[0].kind != desToolBegin || tokens[0].value != "Generator" {
+		return nil, fmt.Errorf("DESTool generator has to start with <Generator>")
+	}
+
+	builder := newModelBuilder(tokens[0].attributes["name"])
+	pos := 1
+	if builder.model.ID == "" && pos < len(tokens) && tokens[pos].kind == desToolString {
+		builder.model.ID = tokens[pos].value
+		pos++
+	}
+
+	for pos < len(tokens) {
+		token := tokens[pos]
+		pos++
+
+		if token.kind == desToolEnd && token.value == "Generator" {
+			return &builder.model, nil
+		}
+		if token.kind != desToolBegin {
+			return nil, fmt.Errorf("unexpected token %s in DESTool generator", token.value)
+		}
+
+		section, next, err := desToolSection(tokens, pos, token.value)
+		if err != nil {
+			return nil, err
+		}
+		pos = next
+
+		switch token.value {
+		case "Alphabet":
+			for i := 0; i < len(section); i++ {
+				if section[i].kind == desToolOption {
+					continue
+				}
+				controllable := false
+				observable := true
+				if i+1 < len(section) && section[i+1].kind == desToolOption {
+					controllable = strings.Contains(section[i+1].value, "C")
+					observable = !strings.Contains(section[i+1].value, "o")
+				}
+				builder.addEvent(section[i].value, controllable, observable)
+			}
+		case "States":
+			for _, name := range desToolNames(section) {
+				builder.addState(name)
+			}
+		case "TransRel":
+			entries := make([]desToolToken, 0, len(section))
+			for _, t := range section {
+				if t.kind != desToolOption {
+					entries = append(entries, t)
+				}
+			}
+			if len(entries)%3 != 0 {
+				return nil, fmt.Errorf("incomplete transition in DESTool generator")
+			}
+			for i := 0; i < len(entries); i += 3 {
+				if err := builder.addTransition(entries[i].value, entries[i+1].value, entries[i+2].value); err != nil {
+					return nil, err
+				}
+			}
+		case "InitStates":
+			for _, name := range desToolNames(section) {
+				builder.addState(name).Initial = "True"
+			}
+		case "MarkedStates":
+			for _, name := range desToolNames(section) {
+				builder.addState(name).Marked = "True"
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("DESTool generator misses </Generator>")
+}
+
+// desToolSection returns all tokens up to the end of the given section. Nested
+// sections other than <Consecutive> are skipped.
+func desToolSection(tokens []desToolToken, pos int, name string) ([]desToolToken, int, error) {
+	section := make([]desToolToken, 0)
+	depth := 0
+
+	for ; pos < len(tokens); pos++ {
+		token := tokens[pos]
+		switch {
+		case token.kind == desToolEnd && depth == 0:
+			if token.value != name {
+				return nil, 0, fmt.Errorf("expected </%s> in DESTool generator, got </%s>", name, token.value)
+			}
+			return section, pos + 1, nil
+		case token.kind == desToolBegin && token.value == "Consecutive":
+			section = append(section, token)
+		case token.kind == desToolEnd && token.value == "Consecutive":
+			section = append(section, token)
+		case token.kind == desToolBegin:
+			depth++
+		case token.kind == desToolEnd:
+			depth--
+		case depth == 0:
+			section = append(section, token)
+		}
+	}
+
+	return nil, 0, fmt.Errorf("DESTool generator misses </%s>", name)
+}
+
+// desToolNames expands <Consecutive> ranges of state indices.
+func desToolNames(section []desToolToken) []string {
+	names := make([]string, 0, len(section))
+
+	for i := 0; i < len(section); i++ {
+		token := section[i]
+		switch {
+		case token.kind == desToolBegin && i+3 < len(section):
+			from, _ := strconv.Atoi(section[i+1].value)
+			to, _ := strconv.Atoi(section[i+2].value)
+			for index := from; index <= to; index++ {
+				names = append(names, strconv.Itoa(index))
+			}
+			i += 3
+		case token.kind == desToolString || token.kind == desToolInteger:
+			names = append(names, token.value)
+		}
+	}
+
+	return names
+}
+
+func writeDESTool(w io.Writer, model Model) error {
+	stateNames, eventNames := model.Data.labels()
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "<Generator>\n%s\n\n", strconv.Quote(model.ID))
+
+	sb.WriteString("<Alphabet>\n")
+	for _, e := range model.Data.Events {
+		sb.WriteString(strconv.Quote(e.Name))
+		options := ""
+		if isTrue(e.Controllable) {
+			options += "C"
+		}
+		if e.Observable != "" && !isTrue(e.Observable) {
+			options += "o"
+		}
+		if options != "" {
+			fmt.Fprintf(&sb, " +%s+", options)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</Alphabet>\n\n")
+
+	sb.WriteString("<States>\n")
+	for _, s := range model.Data.States {
+		fmt.Fprintf(&sb, "%s\n", strconv.Quote(stateNames[s.ID]))
+	}
+	sb.WriteString("</States>\n\n")
+
+	sb.WriteString("<TransRel>\n")
+	for _, t := range model.Data.Transitions {
+		fmt.Fprintf(&sb, "%s %s %s\n", strconv.Quote(stateNames[t.Source]), strconv.Quote(eventNames[t.Event]), strconv.Quote(stateNames[t.Target]))
+	}
+	sb.WriteString("</TransRel>\n\n")
+
+	sb.WriteString("<InitStates>\n")
+	for _, s := range model.Data.States {
+		if isTrue(s.Initial) {
+			fmt.Fprintf(&sb, "%s\n", strconv.Quote(stateNames[s.ID]))
+		}
+	}
+	sb.WriteString("</InitStates>\n\n")
+
+	sb.WriteString("<MarkedStates>\n")
+	for _, s := range model.Data.States {
+		if isTrue(s.Marked) {
+			fmt.Fprintf(&sb, "%s\n", strconv.Quote(stateNames[s.ID]))
+		}
+	}
+	sb.WriteString("</MarkedStates>\n")
+	sb.WriteString("</Generator>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
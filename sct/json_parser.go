@@ -0,0 +1,113 @@
+package sct
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Structs to represent the JSON automaton format
+type jsonAutomaton struct {
+	Name        string           `json:"name"`
+	Events      []jsonEvent      `json:"events"`
+	States      []jsonState      `json:"states"`
+	Transitions []jsonTransition `json:"transitions"`
+}
+
+type jsonEvent struct {
+	Name         string `json:"name"`
+	Controllable bool   `json:"controllable"`
+	Observable   *bool  `json:"observable,omitempty"`
+}
+
+type jsonState struct {
+	Name    string `json:"name"`
+	Initial bool   `json:"initial,omitempty"`
+	Marked  bool   `json:"marked,omitempty"`
+}
+
+type jsonTransition struct {
+	Source string `json:"source"`
+	Event  string `json:"event"`
+	Target string `json:"target"`
+}
+
+// parseJSON reads either a single automaton object or an array of automata.
+func parseJSON(content io.Reader) ([]Model, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var automata []jsonAutomaton
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var automaton jsonAutomaton
+		if err := json.Unmarshal(data, &automaton); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON: %v", err)
+		}
+		automata = append(automata, automaton)
+	} else if err := json.Unmarshal(data, &automata); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %v", err)
+	}
+
+	models := make([]Model, 0, len(automata))
+	for _, automaton := range automata {
+		builder := newModelBuilder(automaton.Name)
+
+		for _, e := range automaton.Events {
+			builder.addEvent(e.Name, e.Controllable, e.Observable == nil || *e.Observable)
+		}
+
+		for _, s := range automaton.States {
+			state := builder.addState(s.Name)
+			state.Initial = boolString(s.Initial)
+			state.Marked = boolString(s.Marked)
+		}
+
+		for _, t := range automaton.Transitions {
+			if err := builder.addTransition(t.Source, t.Event, t.Target); err != nil {
+				return nil, err
+			}
+		}
+
+		models = append(models, builder.model)
+	}
+
+	return models, nil
+}
+
+func writeJSON(w io.Writer, models []Model) error {
+	automata := make([]jsonAutomaton, 0, len(models))
+
+	for _, model := range models {
+		stateNames, eventNames := model.Data.labels()
+		automaton := jsonAutomaton{Name: model.ID}
+
+		for _, e := range model.Data.Events {
+			event := jsonEvent{Name: e.Name, Controllable: isTrue(e.Controllable)}
+			if e.Observable != "" && !isTrue(e.Observable) {
+				observable := false
+				event.Observable = &observable
+			}
+			automaton.Events = append(automaton.Events, event)
+		}
+
+		for _, s := range model.Data.States {
+			automaton.States = append(automaton.States, jsonState{Name: stateNames[s.ID], Initial: isTrue(s.Initial), Marked: isTrue(s.Marked)})
+		}
+
+		for _, t := range model.Data.Transitions {
+			automaton.Transitions = append(automaton.Transitions, jsonTransition{Source: stateNames[t.Source], Event: eventNames[t.Event], Target: stateNames[t.Target]})
+		}
+
+		automata = append(automata, automaton)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if len(automata) == 1 {
+		return encoder.Encode(automata[0])
+	}
+	return encoder.Encode(automata)
+}
@@ -0,0 +1,282 @@
+package sct
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatFSA
+	FormatSupremicaModule
+	FormatSupremicaProject
+	FormatDESTool
+	FormatJSON
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatFSA:
+		return "fsa"
+	case FormatSupremicaModule:
+		return "wmod"
+	case FormatSupremicaProject:
+		return "supremica"
+	case FormatDESTool:
+		return "gen"
+	case FormatJSON:
+		return "json"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFormat returns the format for a name as returned by Format.String or
+// for a file extension like ".wmod".
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "fsa":
+		return FormatFSA, nil
+	case "wmod":
+		return FormatSupremicaModule, nil
+	case "supremica":
+		return FormatSupremicaProject, nil
+	case "gen", "destool":
+		return FormatDESTool, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return FormatUnknown, fmt.Errorf("unknown model format %s", name)
+	}
+}
+
+// DetectFormat guesses the format of a supervisor definition from its content.
+func DetectFormat(content []byte) Format {
+	trimmed := bytes.TrimSpace(stripDESToolComments(content))
+	trimmed = bytes.TrimPrefix(trimmed, []byte("\xef\xbb\xbf"))
+
+	switch {
+	case len(trimmed) == 0:
+		return FormatUnknown
+	case trimmed[0] == '{' || trimmed[0] == '[':
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte("<Generator")):
+		return FormatDESTool
+	case trimmed[0] != '<':
+		return FormatUnknown
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+	decoder.CharsetReader = charsetReader
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return FormatUnknown
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "model":
+				return FormatFSA
+			case "Module":
+				return FormatSupremicaModule
+			case "Automata", "Automaton":
+				return FormatSupremicaProject
+			default:
+				return FormatUnknown
+			}
+		}
+	}
+}
+
+// Load reads all supervisors of a definition given in any of the supported
+// formats. Supremica files can contain more than one automaton.
+func Load(content io.Reader) ([]Model, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	format := DetectFormat(data)
+	switch format {
+	case FormatFSA:
+		model, err := ParseXML(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return []Model{*model}, nil
+	case FormatSupremicaModule:
+		return parseSupremicaModule(bytes.NewReader(data))
+	case FormatSupremicaProject:
+		return parseSupremicaProject(bytes.NewReader(data))
+	case FormatDESTool:
+		model, err := parseDESTool(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return []Model{*model}, nil
+	case FormatJSON:
+		return parseJSON(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unknown model format")
+	}
+}
+
+// Export writes the given supervisors in the requested format. The FSA and
+// DESTool formats can hold exactly one supervisor.
+func Export(w io.Writer, format Format, models ...Model) error {
+	switch format {
+	case FormatFSA, FormatDESTool:
+		if len(models) != 1 {
+			return fmt.Errorf("format %s holds exactly one supervisor, got %d", format, len(models))
+		}
+		if format == FormatFSA {
+			return WriteXML(w, models[0])
+		}
+		return writeDESTool(w, models[0])
+	case FormatSupremicaModule:
+		return writeSupremicaModule(w, models)
+	case FormatSupremicaProject:
+		return writeSupremicaProject(w, models)
+	case FormatJSON:
+		return writeJSON(w, models)
+	default:
+		return fmt.Errorf("unknown model format")
+	}
+}
+
+// labels returns unique names for all states and events of a model, indexed by
+// their ids. Names are used if they are unique, ids otherwise.
+func (data Data) labels() (map[string]string, map[string]string) {
+	stateNames := make(map[string]string)
+	stateNameCount := make(map[string]int)
+	for _, s := range data.States {
+		stateNameCount[s.Name]++
+	}
+	for _, s := range data.States {
+		if s.Name != "" && stateNameCount[s.Name] == 1 {
+			stateNames[s.ID] = s.Name
+		} else {
+			stateNames[s.ID] = s.ID
+		}
+	}
+
+	eventNames := make(map[string]string)
+	for _, e := range data.Events {
+		eventNames[e.ID] = e.Name
+	}
+
+	return stateNames, eventNames
+}
+
+// modelBuilder assembles a model from formats that reference states and events
+// by name instead of id.
+type modelBuilder struct {
+	model  Model
+	states map[string]int
+	events map[string]int
+}
+
+func newModelBuilder(name string) *modelBuilder {
+	return &modelBuilder{
+		model:  Model{Version: "0.0", Type: "FSA", ID: name},
+		states: make(map[string]int),
+		events: make(map[string]int),
+	}
+}
+
+func (b *modelBuilder) addState(name string) *State {
+	if i, ok := b.states[name]; ok {
+		return &b.model.Data.States[i]
+	}
+
+	b.states[name] = len(b.model.Data.States)
+	b.model.Data.States = append(b.model.Data.States, State{ID: strconv.Itoa(len(b.model.Data.States)), Name: name, Initial: "False", Marked: "False"})
+	return &b.model.Data.States[len(b.model.Data.States)-1]
+}
+
+func (b *modelBuilder) addEvent(name string, controllable bool, observable bool) *Event {
+	if i, ok := b.events[name]; ok {
+		return &b.model.Data.Events[i]
+	}
+
+	b.events[name] = len(b.model.Data.Events)
+	b.model.Data.Events = append(b.model.Data.Events, Event{ID: strconv.Itoa(len(b.model.Data.Events)), Name: name, Controllable: boolString(controllable), Observable: boolString(observable)})
+	return &b.model.Data.Events[len(b.model.Data.Events)-1]
+}
+
+func (b *modelBuilder) addTransition(source string, event string, target string) error {
+	e, ok := b.events[event]
+	if !ok {
+		return fmt.Errorf("transition %s -%s-> %s uses unknown event %s", source, event, target, event)
+	}
+
+	b.model.Data.Transitions = append(b.model.Data.Transitions, Transition{
+		Source: b.addState(source).ID,
+		Target: b.addState(target).ID,
+		Event:  b.model.Data.Events[e].ID,
+	})
+	return nil
+}
+
+func isTrue(value string) bool {
+	return strings.EqualFold(value, "true")
+}
+
+func boolString(value bool) string {
+	if value {
+		return "True"
+	}
+	return "False"
+}
+
+// charsetReader supports the ISO-8859-1 encoding Supremica uses by default.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1", "us-ascii":
+		return &latin1Reader{r: bufio.NewReader(input)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+}
+
+type latin1Reader struct {
+	r       *bufio.Reader
+	pending []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.pending) > 0 {
+			c := copy(p[n:], l.pending)
+			l.pending = l.pending[c:]
+			n += c
+			continue
+		}
+
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if b < 0x80 {
+			p[n] = b
+			n++
+		} else {
+			l.pending = []byte(string(rune(b)))
+		}
+	}
+
+	return n, nil
+}
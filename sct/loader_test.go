@@ -0,0 +1,206 @@
+package sct
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+const supremicaModuleDefinition = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Module Name="machine" xmlns="http://waters.sourceforge.net/xsd/module" xmlns:B="http://waters.sourceforge.net/xsd/base">
+<B:Comment>simple machine</B:Comment>
+<EventDeclList>
+<EventDecl Kind="CONTROLLABLE" Name="start"/>
+<EventDecl Kind="UNCONTROLLABLE" Name="finish"/>
+<EventDecl Kind="PROPOSITION" Name=":accepting"/>
+</EventDeclList>
+<ComponentList>
+<SimpleComponent Kind="PLANT" Name="machine">
+<Graph>
+<NodeList>
+<SimpleNode Initial="true" Name="idle">
+<EventList>
+<SimpleIdentifier Name=":accepting"/>
+</EventList>
+</SimpleNode>
+<SimpleNode Name="working"/>
+</NodeList>
+<EdgeList>
+<Edge Source="idle" Target="working">
+<LabelBlock>
+<SimpleIdentifier Name="start"/>
+</LabelBlock>
+</Edge>
+<Edge Source="working" Target="idle">
+<LabelBlock>
+<SimpleIdentifier Name="finish"/>
+</LabelBlock>
+</Edge>
+</EdgeList>
+</Graph>
+</SimpleComponent>
+</ComponentList>
+</Module>`
+
+const supremicaProjectDefinition = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<Automata name="machine" major="0" minor="9">
+<Automaton name="machine" type="Plant">
+	<Events>
+		<Event id="0" label="start"/>
+		<Event id="1" label="finish" controllable="false"/>
+	</Events>
+	<States>
+		<State id="0" name="idle" initial="true" accepting="true"/>
+		<State id="1" name="working"/>
+	</States>
+	<Transitions>
+		<Transition source="0" dest="1" event="0"/>
+		<Transition source="1" dest="0" event="1"/>
+	</Transitions>
+</Automaton>
+</Automata>`
+
+const desToolDefinition = `% simple machine
+<Generator>
+"machine"
+
+<Alphabet>
+"start" +C+ "finish"
+</Alphabet>
+
+<States>
+"idle" "working"
+</States>
+
+<TransRel>
+"idle" "start" "working"
+"working" "finish" "idle"
+</TransRel>
+
+<InitStates>
+"idle"
+</InitStates>
+
+<MarkedStates>
+"idle"
+</MarkedStates>
+</Generator>`
+
+const jsonDefinition = `{
+	"name": "machine",
+	"events": [{"name": "start", "controllable": true}, {"name": "finish"}],
+	"states": [{"name": "idle", "initial": true, "marked": true}, {"name": "working"}],
+	"transitions": [
+		{"source": "idle", "event": "start", "target": "working"},
+		{"source": "working", "event": "finish", "target": "idle"}
+	]
+}`
+
+func TestDetectFormat(t *testing.T) {
+	fsa, err := os.ReadFile("../resources/simpleController1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Format{
+		string(fsa):                   FormatFSA,
+		supremicaModuleDefinition:     FormatSupremicaModule,
+		supremicaProjectDefinition:    FormatSupremicaProject,
+		desToolDefinition:             FormatDESTool,
+		jsonDefinition:                FormatJSON,
+		"this is no automaton at all": FormatUnknown,
+	}
+
+	for definition, expected := range tests {
+		if format := DetectFormat([]byte(definition)); format != expected {
+			t.Errorf("Wrong format detected: expected %s, got %s", expected, format)
+		}
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	for _, definition := range []string{supremicaModuleDefinition, supremicaProjectDefinition, desToolDefinition, jsonDefinition} {
+		models, err := Load(strings.NewReader(definition))
+		if err != nil {
+			t.Fatalf("Could not load %s: %s", DetectFormat([]byte(definition)), err)
+		}
+
+		if len(models) != 1 {
+			t.Fatalf("Wrong number of models: %d", len(models))
+		}
+
+		assertMachine(t, models[0])
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	models, err := Load(strings.NewReader(jsonDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []Format{FormatFSA, FormatSupremicaModule, FormatSupremicaProject, FormatDESTool, FormatJSON} {
+		var buf bytes.Buffer
+		if err := Export(&buf, format, models...); err != nil {
+			t.Fatalf("Could not export %s: %s", format, err)
+		}
+
+		if detected := DetectFormat(buf.Bytes()); detected != format {
+			t.Errorf("Exported %s is detected as %s", format, detected)
+		}
+
+		reloaded, err := Load(&buf)
+		if err != nil {
+			t.Fatalf("Could not reload %s: %s", format, err)
+		}
+
+		assertMachine(t, reloaded[0])
+	}
+}
+
+func TestLoadFSAResources(t *testing.T) {
+	f, err := os.Open("../resources/simpleController1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	models, err := Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models[0].Data.States) != 6 || len(models[0].Data.Events) != 5 || len(models[0].Data.Transitions) != 14 {
+		t.Errorf("Wrong model loaded: %+v", models[0].Data)
+	}
+}
+
+func assertMachine(t *testing.T, model Model) {
+	t.Helper()
+
+	stateNames, eventNames := model.Data.labels()
+
+	controllable := make(map[string]bool)
+	for _, e := range model.Data.Events {
+		controllable[e.Name] = isTrue(e.Controllable)
+	}
+	if len(controllable) != 2 || !controllable["start"] || controllable["finish"] {
+		t.Errorf("Wrong events: %+v", model.Data.Events)
+	}
+
+	for _, s := range model.Data.States {
+		idle := stateNames[s.ID] == "idle"
+		if isTrue(s.Initial) != idle || isTrue(s.Marked) != idle {
+			t.Errorf("Wrong state: %+v", s)
+		}
+	}
+
+	transitions := make(map[string]bool)
+	for _, tr := range model.Data.Transitions {
+		transitions[stateNames[tr.Source]+"-"+eventNames[tr.Event]+"-"+stateNames[tr.Target]] = true
+	}
+	if len(transitions) != 2 || !transitions["idle-start-working"] || !transitions["working-finish-idle"] {
+		t.Errorf("Wrong transitions: %v", transitions)
+	}
+}
@@ -0,0 +1,402 @@
+package sct
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ReductionReport describes the effect of Minimize or Reduce on a supervisor.
+type ReductionReport struct {
+	Supervisor   string
+	StatesBefore int
+	StatesAfter  int
+}
+
+func (r ReductionReport) String() string {
+	return fmt.Sprintf("%s: %d -> %d states", r.Supervisor, r.StatesBefore, r.StatesAfter)
+}
+
+// automaton is an index based view of a model used by the algorithms on
+// supervisors. Transitions are stored per state and event index, -1 marks a
+// missing transition.
+type automaton struct {
+	model       Model
+	initial     int
+	marked      []bool
+	events      []string
+	eventIndex  map[string]int
+	transitions [][]int
+}
+
+func newAutomaton(model Model) *automaton {
+	a := &automaton{
+		model:       model,
+		initial:     -1,
+		marked:      make([]bool, len(model.Data.States)),
+		events:      make([]string, len(model.Data.Events)),
+		eventIndex:  make(map[string]int),
+		transitions: make([][]int, len(model.Data.States)),
+	}
+
+	stateIndex := make(map[string]int)
+	for i, s := range model.Data.States {
+		stateIndex[s.ID] = i
+		a.marked[i] = isTrue(s.Marked)
+		if isTrue(s.Initial) && a.initial == -1 {
+			a.initial = i
+		}
+	}
+
+	eventIdIndex := make(map[string]int)
+	for i, e := range model.Data.Events {
+		eventIdIndex[e.ID] = i
+		a.events[i] = e.Name
+		a.eventIndex[e.Name] = i
+	}
+
+	for i := range a.transitions {
+		a.transitions[i] = make([]int, len(a.events))
+		for e := range a.transitions[i] {
+			a.transitions[i][e] = -1
+		}
+	}
+
+	for _, t := range model.Data.Transitions {
+		source, ok1 := stateIndex[t.Source]
+		target, ok2 := stateIndex[t.Target]
+		event, ok3 := eventIdIndex[t.Event]
+		if ok1 && ok2 && ok3 {
+			a.transitions[source][event] = target
+		}
+	}
+
+	return a
+}
+
+// reachable returns the states reachable from the initial state in ascending
+// order.
+func (a *automaton) reachable() []int {
+	if a.initial == -1 {
+		return []int{}
+	}
+
+	visited := map[int]bool{a.initial: true}
+	queue := []int{a.initial}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, target := range a.transitions[s] {
+			if target != -1 && !visited[target] {
+				visited[target] = true
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	states := make([]int, 0, len(visited))
+	for s := range visited {
+		states = append(states, s)
+	}
+	sort.Ints(states)
+	return states
+}
+
+// quotient builds a model with one state per class. All states of a class
+// need to agree on the class of their successors.
+func (a *automaton) quotient(states []int, class map[int]int, marked func(members []int) bool) Model {
+	members := make(map[int][]int)
+	numClasses := 0
+	for _, s := range states {
+		members[class[s]] = append(members[class[s]], s)
+		if class[s]+1 > numClasses {
+			numClasses = class[s] + 1
+		}
+	}
+
+	model := Model{Version: a.model.Version, Type: a.model.Type, ID: a.model.ID}
+	model.Data.Events = append(model.Data.Events, a.model.Data.Events...)
+
+	for c := 0; c < numClasses; c++ {
+		representative := a.model.Data.States[members[c][0]]
+		model.Data.States = append(model.Data.States, State{
+			ID:      strconv.Itoa(c),
+			Name:    representative.Name,
+			Initial: boolString(class[a.initial] == c),
+			Marked:  boolString(marked(members[c])),
+		})
+
+		added := make(map[int]bool)
+		for _, s := range members[c] {
+			for e, target := range a.transitions[s] {
+				if target == -1 || added[e] {
+					continue
+				}
+				added[e] = true
+				model.Data.Transitions = append(model.Data.Transitions, Transition{
+					Source: strconv.Itoa(c),
+					Target: strconv.Itoa(class[target]),
+					Event:  a.model.Data.Events[e].ID,
+				})
+			}
+		}
+	}
+
+	return model
+}
+
+// Minimize removes unreachable states and merges equivalent states of a
+// supervisor. The result accepts the same language and marks the same
+// language, so enabled events stay the same after every event sequence.
+func Minimize(model Model) (Model, ReductionReport) {
+	report := ReductionReport{Supervisor: model.ID, StatesBefore: len(model.Data.States)}
+
+	a := newAutomaton(model)
+	if a.initial == -1 {
+		report.StatesAfter = report.StatesBefore
+		return model, report
+	}
+
+	states := a.reachable()
+
+	// Moore's partition refinement, starting with marked and unmarked states
+	class := make(map[int]int)
+	for _, s := range states {
+		if a.marked[s] {
+			class[s] = 1
+		} else {
+			class[s] = 0
+		}
+	}
+
+	numClasses := -1
+	for {
+		signatures := make(map[string]int)
+		refined := make(map[int]int)
+		for _, s := range states {
+			signature := strconv.Itoa(class[s])
+			for _, target := range a.transitions[s] {
+				if target == -1 {
+					signature += ",-"
+				} else {
+					signature += "," + strconv.Itoa(class[target])
+				}
+			}
+
+			if _, ok := signatures[signature]; !ok {
+				signatures[signature] = len(signatures)
+			}
+			refined[s] = signatures[signature]
+		}
+
+		class = refined
+		if len(signatures) == numClasses {
+			break
+		}
+		numClasses = len(signatures)
+	}
+
+	minimized := a.quotient(states, class, func(members []int) bool { return a.marked[members[0]] })
+	report.StatesAfter = len(minimized.Data.States)
+
+	return minimized, report
+}
+
+// controlData holds the control information of a supervisor state with respect
+// to a plant, as used by supervisor reduction.
+type controlData struct {
+	enabled       map[int]bool // events defined in the supervisor state
+	disabled      map[int]bool // events the plant allows but the supervisor state prevents
+	marked        bool         // supervisor state is marked
+	plantMarkable bool         // a marked plant state is reachable together with this supervisor state
+}
+
+func (c controlData) consistentWith(o controlData) bool {
+	for e := range c.enabled {
+		if o.disabled[e] {
+			return false
+		}
+	}
+	for e := range o.enabled {
+		if c.disabled[e] {
+			return false
+		}
+	}
+	return c.plantMarkable != o.plantMarkable || c.marked == o.marked
+}
+
+// Reduce merges control consistent states of a supervisor with respect to the
+// given plant. The reduced supervisor has in general not the same language as
+// the original one, but the closed loop with the plant behaves identically.
+func Reduce(supervisor Model, plant Model) (Model, ReductionReport, error) {
+	report := ReductionReport{Supervisor: supervisor.ID, StatesBefore: len(supervisor.Data.States)}
+
+	s := newAutomaton(supervisor)
+	p := newAutomaton(plant)
+	if s.initial == -1 || p.initial == -1 {
+		return supervisor, report, fmt.Errorf("supervisor %s or plant %s has no initial state", supervisor.ID, plant.ID)
+	}
+
+	data := make(map[int]*controlData)
+	type pair struct{ s, p int }
+	visited := map[pair]bool{{s.initial, p.initial}: true}
+	queue := []pair{{s.initial, p.initial}}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		d, ok := data[current.s]
+		if !ok {
+			d = &controlData{enabled: make(map[int]bool), disabled: make(map[int]bool), marked: s.marked[current.s]}
+			for e, target := range s.transitions[current.s] {
+				if target != -1 {
+					d.enabled[e] = true
+				}
+			}
+			data[current.s] = d
+		}
+		d.plantMarkable = d.plantMarkable || p.marked[current.p]
+
+		for pe, plantTarget := range p.transitions[current.p] {
+			if plantTarget == -1 {
+				continue
+			}
+
+			next := pair{current.s, plantTarget}
+			if se, ok := s.eventIndex[p.events[pe]]; ok {
+				if s.transitions[current.s][se] == -1 {
+					d.disabled[se] = true
+					continue
+				}
+				next.s = s.transitions[current.s][se]
+			}
+
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	states := make([]int, 0, len(data))
+	for state := range data {
+		states = append(states, state)
+	}
+	sort.Ints(states)
+
+	// every supervisor state reached in the closed loop starts in its own class
+	class := make(map[int]int)
+	for i, state := range states {
+		class[state] = i
+	}
+
+	for i, x := range states {
+		for _, y := range states[i+1:] {
+			if class[x] == class[y] {
+				continue
+			}
+
+			if merged, ok := s.tryMerge(class, data, x, y); ok {
+				class = merged
+			}
+		}
+	}
+
+	// renumber classes consecutively
+	renumbered := make(map[int]int)
+	for _, state := range states {
+		if _, ok := renumbered[class[state]]; !ok {
+			renumbered[class[state]] = len(renumbered)
+		}
+	}
+	for _, state := range states {
+		class[state] = renumbered[class[state]]
+	}
+
+	// states which are never reached in the closed loop are removed
+	for _, state := range states {
+		for e, target := range s.transitions[state] {
+			if _, ok := class[target]; target != -1 && !ok {
+				s.transitions[state][e] = -1
+			}
+		}
+	}
+
+	reduced := s.quotient(states, class, func(members []int) bool {
+		marked := false
+		for _, m := range members {
+			if data[m].plantMarkable {
+				return data[m].marked
+			}
+			marked = marked || data[m].marked
+		}
+		return marked
+	})
+	report.StatesAfter = len(reduced.Data.States)
+
+	return reduced, report, nil
+}
+
+// tryMerge merges the classes of x and y and all classes that have to be merged
+// to keep the result deterministic. It fails if the merged classes contain
+// control inconsistent states.
+func (a *automaton) tryMerge(class map[int]int, data map[int]*controlData, x int, y int) (map[int]int, bool) {
+	merged := make(map[int]int, len(class))
+	for state, c := range class {
+		merged[state] = c
+	}
+
+	type pair struct{ x, y int }
+	pending := []pair{{x, y}}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		from, to := merged[current.x], merged[current.y]
+		if from == to {
+			continue
+		}
+
+		members := make([]int, 0)
+		for state, c := range merged {
+			if c == from || c == to {
+				members = append(members, state)
+			}
+		}
+
+		for i, m := range members {
+			for _, n := range members[i+1:] {
+				if !data[m].consistentWith(*data[n]) {
+					return nil, false
+				}
+			}
+		}
+
+		for _, m := range members {
+			merged[m] = to
+		}
+
+		sort.Ints(members)
+		for e := range a.events {
+			first := -1
+			for _, m := range members {
+				target := a.transitions[m][e]
+				if target == -1 {
+					continue
+				}
+				if _, ok := merged[target]; !ok {
+					continue
+				}
+				if first == -1 {
+					first = target
+				} else if merged[first] != merged[target] {
+					pending = append(pending, pair{first, target})
+				}
+			}
+		}
+	}
+
+	return merged, true
+}
@@ -0,0 +1,118 @@
+package sct
+
+import (
+	"strings"
+	"testing"
+)
+
+const plantDefinition = `{
+	"name": "machine",
+	"events": [{"name": "start", "controllable": true}, {"name": "finish"}],
+	"states": [{"name": "idle", "initial": true, "marked": true}, {"name": "working"}],
+	"transitions": [
+		{"source": "idle", "event": "start", "target": "working"},
+		{"source": "working", "event": "finish", "target": "idle"}
+	]
+}`
+
+func loadSingle(t *testing.T, definition string) Model {
+	t.Helper()
+
+	models, err := Load(strings.NewReader(definition))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models[0]
+}
+
+func TestMinimize(t *testing.T) {
+	model := loadSingle(t, `{
+		"name": "ring",
+		"events": [{"name": "a", "controllable": true}],
+		"states": [{"name": "0", "initial": true, "marked": true}, {"name": "1"}, {"name": "2", "marked": true}, {"name": "3"}, {"name": "unreachable"}],
+		"transitions": [
+			{"source": "0", "event": "a", "target": "1"},
+			{"source": "1", "event": "a", "target": "2"},
+			{"source": "2", "event": "a", "target": "3"},
+			{"source": "3", "event": "a", "target": "0"},
+			{"source": "unreachable", "event": "a", "target": "0"}
+		]
+	}`)
+
+	minimized, report := Minimize(model)
+
+	if report.StatesBefore != 5 || report.StatesAfter != 2 || len(minimized.Data.States) != 2 {
+		t.Errorf("Wrong minimization: %s", report)
+	}
+
+	if len(minimized.Data.Transitions) != 2 {
+		t.Errorf("Wrong number of transitions: %d", len(minimized.Data.Transitions))
+	}
+}
+
+func TestMinimizeKeepsMinimalSupervisor(t *testing.T) {
+	model := loadSingle(t, plantDefinition)
+
+	_, report := Minimize(model)
+
+	if report.StatesAfter != 2 {
+		t.Errorf("Wrong minimization: %s", report)
+	}
+}
+
+func TestReduceRedundantMemory(t *testing.T) {
+	supervisor := loadSingle(t, `{
+		"name": "counter",
+		"events": [{"name": "start", "controllable": true}, {"name": "finish"}],
+		"states": [{"name": "0", "initial": true, "marked": true}, {"name": "1"}, {"name": "2", "marked": true}, {"name": "3"}],
+		"transitions": [
+			{"source": "0", "event": "start", "target": "1"},
+			{"source": "1", "event": "finish", "target": "2"},
+			{"source": "2", "event": "start", "target": "3"},
+			{"source": "3", "event": "finish", "target": "0"}
+		]
+	}`)
+
+	reduced, report, err := Reduce(supervisor, loadSingle(t, plantDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.StatesAfter != 1 || len(reduced.Data.States) != 1 || !isTrue(reduced.Data.States[0].Marked) {
+		t.Errorf("Wrong reduction: %s", report)
+	}
+}
+
+func TestReduceKeepsDisablement(t *testing.T) {
+	supervisor := loadSingle(t, `{
+		"name": "once",
+		"events": [{"name": "start", "controllable": true}, {"name": "finish"}],
+		"states": [{"name": "0", "initial": true, "marked": true}, {"name": "1"}, {"name": "2", "marked": true}],
+		"transitions": [
+			{"source": "0", "event": "start", "target": "1"},
+			{"source": "1", "event": "finish", "target": "2"}
+		]
+	}`)
+
+	reduced, report, err := Reduce(supervisor, loadSingle(t, plantDefinition))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.StatesAfter != 2 {
+		t.Fatalf("Wrong reduction: %s", report)
+	}
+
+	// start has to stay disabled after the first cycle
+	a := newAutomaton(reduced)
+	state := a.initial
+	for _, event := range []string{"start", "finish"} {
+		state = a.transitions[state][a.eventIndex[event]]
+		if state == -1 {
+			t.Fatalf("Event %s got disabled", event)
+		}
+	}
+	if a.transitions[state][a.eventIndex["start"]] != -1 {
+		t.Errorf("start is enabled after the first cycle")
+	}
+}
@@ -2,10 +2,12 @@ package sct
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"slices"
+	"sync/atomic"
 )
 
 type SCT struct {
@@ -13,10 +15,30 @@ type SCT struct {
 	callbacks         map[string]func()
 	eventsLookupTable map[string]event
 
+	onDisabledEvent     func(supervisor string, event string)
+	disabledEventsCount atomic.Uint64
+
 	eventChannel chan string
 }
 
-func NewSCT(xmlDefinitions []io.Reader, callbacks map[string]func()) (*SCT, error) {
+// NewSCT creates a SCT from supervisor definitions given in any of the formats
+// supported by Load.
+func NewSCT(definitions []io.Reader, callbacks map[string]func()) (*SCT, error) {
+	models := make([]Model, 0, len(definitions))
+	for _, definition := range definitions {
+		loaded, err := Load(definition)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, loaded...)
+	}
+
+	return NewSCTFromModels(models, callbacks)
+}
+
+// NewSCTFromModels creates a SCT from already parsed supervisors, e.g. the
+// transition tables generated by cmd/sctgen.
+func NewSCTFromModels(models []Model, callbacks map[string]func()) (*SCT, error) {
 	sct := &SCT{
 		supervisors:       []*supervisor{},
 		callbacks:         callbacks,
@@ -24,11 +46,11 @@ func NewSCT(xmlDefinitions []io.Reader, callbacks map[string]func()) (*SCT, erro
 		eventChannel:      make(chan string, 10),
 	}
 
-	for _, xmlDefinition := range xmlDefinitions {
-		model, err := parseXML(xmlDefinition)
-		if err != nil {
-			return nil, err
-		}
+	minimizedModels := make([]Model, 0, len(models))
+	for i, model := range models {
+		model, report := Minimize(model)
+		log.Printf("SCT - minimized supervisor %s", report)
+		minimizedModels = append(minimizedModels, model)
 
 		eventList := make([]event, 0)
 		eventIdLookupTable := make(map[string]event)
@@ -41,7 +63,18 @@ func NewSCT(xmlDefinitions []io.Reader, callbacks map[string]func()) (*SCT, erro
 
 		intialState := sct.createInitialState(model.Data, eventIdLookupTable)
 
-		sct.supervisors = append(sct.supervisors, &supervisor{intialState, eventList})
+		name := model.ID
+		if name == "" {
+			name = fmt.Sprintf("supervisor%d", i)
+		}
+
+		sct.supervisors = append(sct.supervisors, &supervisor{name, intialState, eventList})
+	}
+
+	if report := CheckNonblocking(minimizedModels); report.Nonblocking {
+		log.Printf("SCT - supervisors are %s", report)
+	} else {
+		log.Printf("SCT - WARNING supervisors are %s", report)
 	}
 
 	return sct, nil
@@ -65,6 +98,20 @@ func (sct *SCT) AddEvent(event string) {
 	sct.eventChannel <- event
 }
 
+// OnDisabledEvent registers a callback for uncontrollable events which are
+// disabled in the current state of a supervisor. Such events are ignored by
+// the supervisor, they indicate that the plant model is wrong. Has to be called
+// before Start.
+func (sct *SCT) OnDisabledEvent(callback func(supervisor string, event string)) {
+	sct.onDisabledEvent = callback
+}
+
+// DisabledEventsCount returns the number of uncontrollable events ignored
+// because they were disabled in a supervisor.
+func (sct *SCT) DisabledEventsCount() uint64 {
+	return sct.disabledEventsCount.Load()
+}
+
 func (sct *SCT) processEvent(event string) {
 	ev, ok := sct.eventsLookupTable[event]
 	if !ok {
@@ -75,7 +122,17 @@ func (sct *SCT) processEvent(event string) {
 	log.Println("SCT - Processing event:", event)
 
 	for _, su := range sct.supervisors {
-		su.changeState(ev)
+		if su.changeState(ev) != EventDisabled {
+			continue
+		}
+
+		log.Printf("SCT - Event %s is disabled in supervisor %s, ignoring it", event, su.name)
+		if !ev.controllable {
+			sct.disabledEventsCount.Add(1)
+			if sct.onDisabledEvent != nil {
+				sct.onDisabledEvent(su.name, event)
+			}
+		}
 	}
 
 	for {
@@ -114,7 +171,7 @@ func (sct *SCT) createState(id string, transitions []Transition, existingStates
 		return existingStates[id]
 	}
 
-	newState := state{transitions: make(map[event]state)}
+	newState := state{id: id, transitions: make(map[event]state)}
 	existingStates[id] = newState
 
 	for _, transition := range transitions {
@@ -1,6 +1,7 @@
 package sct
 
 type state struct {
+	id          string
 	transitions map[event]state
 }
 
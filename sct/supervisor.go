@@ -4,15 +4,59 @@ import (
 	"slices"
 )
 
+// EventClassification describes how a supervisor handled an event.
+type EventClassification int
+
+const (
+	// EventAccepted means the event lead to a different state
+	EventAccepted EventClassification = iota
+	// EventSelfLooped means the event is enabled but does not change the state
+	EventSelfLooped
+	// EventNotInAlphabet means the supervisor does not care about the event
+	EventNotInAlphabet
+	// EventDisabled means the event is part of the alphabet, but not enabled
+	// in the current state
+	EventDisabled
+)
+
+func (c EventClassification) String() string {
+	switch c {
+	case EventAccepted:
+		return "accepted"
+	case EventSelfLooped:
+		return "self-looped"
+	case EventNotInAlphabet:
+		return "not in alphabet"
+	case EventDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
 type supervisor struct {
+	name         string
 	currentState state
 	events       []event
 }
 
-func (su *supervisor) changeState(event event) {
-	if newState, ok := su.currentState.transitions[event]; ok {
-		su.currentState = newState
+func (su *supervisor) changeState(event event) EventClassification {
+	if !su.isEventPresent(event) {
+		return EventNotInAlphabet
 	}
+
+	newState, ok := su.currentState.transitions[event]
+	if !ok {
+		return EventDisabled
+	}
+
+	classification := EventAccepted
+	if newState.id == su.currentState.id {
+		classification = EventSelfLooped
+	}
+
+	su.currentState = newState
+	return classification
 }
 
 func (su *supervisor) getActiveEvents() []event {
@@ -0,0 +1,63 @@
+package sct
+
+import (
+	"testing"
+)
+
+func TestEventClassification(t *testing.T) {
+	model := loadSingle(t, `{
+		"name": "machine",
+		"events": [{"name": "start", "controllable": true}, {"name": "finish"}, {"name": "tick"}],
+		"states": [{"name": "idle", "initial": true, "marked": true}, {"name": "working"}],
+		"transitions": [
+			{"source": "idle", "event": "start", "target": "working"},
+			{"source": "idle", "event": "tick", "target": "idle"},
+			{"source": "working", "event": "finish", "target": "idle"}
+		]
+	}`)
+
+	sct, err := NewSCTFromModels([]Model{model}, map[string]func(){})
+	if err != nil {
+		t.Fatal(err)
+	}
+	su := sct.supervisors[0]
+
+	expectations := []struct {
+		event    event
+		expected EventClassification
+	}{
+		{sct.eventsLookupTable["tick"], EventSelfLooped},
+		{sct.eventsLookupTable["finish"], EventDisabled},
+		{event{name: "other"}, EventNotInAlphabet},
+		{sct.eventsLookupTable["start"], EventAccepted},
+	}
+
+	for _, e := range expectations {
+		if classification := su.changeState(e.event); classification != e.expected {
+			t.Errorf("Wrong classification of %s: expected %s, got %s", e.event.name, e.expected, classification)
+		}
+	}
+}
+
+func TestDisabledUncontrollableEvent(t *testing.T) {
+	sct, err := NewSCTFromModels([]Model{loadSingle(t, plantDefinition)}, map[string]func(){})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var disabledSupervisor, disabledEvent string
+	sct.OnDisabledEvent(func(supervisor string, event string) {
+		disabledSupervisor = supervisor
+		disabledEvent = event
+	})
+
+	sct.processEvent("finish")
+
+	if sct.DisabledEventsCount() != 1 {
+		t.Errorf("Wrong number of disabled events: %d", sct.DisabledEventsCount())
+	}
+
+	if disabledSupervisor != "machine" || disabledEvent != "finish" {
+		t.Errorf("Wrong callback invocation: %s %s", disabledSupervisor, disabledEvent)
+	}
+}
@@ -0,0 +1,327 @@
+package sct
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Structs to represent a Waters/Supremica module (.wmod)
+type supremicaModule struct {
+	XMLName    xml.Name             `xml:"Module"`
+	Xmlns      string               `xml:"xmlns,attr,omitempty"`
+	XmlnsB     string               `xml:"xmlns:B,attr,omitempty"`
+	Name       string               `xml:"Name,attr"`
+	Events     []supremicaEventDecl `xml:"EventDeclList>EventDecl"`
+	Components []supremicaComponent `xml:"ComponentList>SimpleComponent"`
+}
+
+type supremicaEventDecl struct {
+	Kind       string `xml:"Kind,attr"`
+	Name       string `xml:"Name,attr"`
+	Observable string `xml:"Observable,attr,omitempty"`
+}
+
+type supremicaComponent struct {
+	Kind  string         `xml:"Kind,attr"`
+	Name  string         `xml:"Name,attr"`
+	Graph supremicaGraph `xml:"Graph"`
+}
+
+type supremicaGraph struct {
+	Blocked *supremicaLabelBlock `xml:"LabelBlock,omitempty"`
+	Nodes   []supremicaNode      `xml:"NodeList>SimpleNode"`
+	Edges   []supremicaEdge      `xml:"EdgeList>Edge"`
+}
+
+type supremicaNode struct {
+	Initial string               `xml:"Initial,attr,omitempty"`
+	Name    string               `xml:"Name,attr"`
+	Marking *supremicaLabelBlock `xml:"EventList,omitempty"`
+}
+
+type supremicaEdge struct {
+	Source string              `xml:"Source,attr"`
+	Target string              `xml:"Target,attr"`
+	Labels supremicaLabelBlock `xml:"LabelBlock"`
+}
+
+type supremicaLabelBlock struct {
+	Identifiers []supremicaIdentifier `xml:"SimpleIdentifier"`
+}
+
+type supremicaIdentifier struct {
+	Name string `xml:"Name,attr"`
+}
+
+const supremicaAccepting = ":accepting"
+
+// Structs to represent a Supremica project (.xml)
+type supremicaProject struct {
+	XMLName  xml.Name             `xml:"Automata"`
+	Name     string               `xml:"name,attr,omitempty"`
+	Major    string               `xml:"major,attr,omitempty"`
+	Minor    string               `xml:"minor,attr,omitempty"`
+	Automata []supremicaAutomaton `xml:"Automaton"`
+}
+
+type supremicaAutomaton struct {
+	Name        string                `xml:"name,attr"`
+	Type        string                `xml:"type,attr,omitempty"`
+	Events      []supremicaEvent      `xml:"Events>Event"`
+	States      []supremicaState      `xml:"States>State"`
+	Transitions []supremicaTransition `xml:"Transitions>Transition"`
+}
+
+type supremicaEvent struct {
+	ID           string `xml:"id,attr"`
+	Label        string `xml:"label,attr"`
+	Controllable string `xml:"controllable,attr,omitempty"`
+	Observable   string `xml:"observable,attr,omitempty"`
+}
+
+type supremicaState struct {
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr"`
+	Initial   string `xml:"initial,attr,omitempty"`
+	Accepting string `xml:"accepting,attr,omitempty"`
+}
+
+type supremicaTransition struct {
+	Source string `xml:"source,attr"`
+	Dest   string `xml:"dest,attr"`
+	Event  string `xml:"event,attr"`
+}
+
+func parseSupremicaModule(content io.Reader) ([]Model, error) {
+	var module supremicaModule
+	decoder := xml.NewDecoder(content)
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&module); err != nil {
+		return nil, fmt.Errorf("failed to decode Supremica module: %v", err)
+	}
+
+	declarations := make(map[string]supremicaEventDecl)
+	hasAccepting := false
+	for _, e := range module.Events {
+		if e.Kind == "PROPOSITION" {
+			hasAccepting = hasAccepting || e.Name == supremicaAccepting
+			continue
+		}
+		declarations[e.Name] = e
+	}
+
+	models := make([]Model, 0, len(module.Components))
+	for _, component := range module.Components {
+		builder := newModelBuilder(component.Name)
+
+		addEvent := func(name string) error {
+			declaration, ok := declarations[name]
+			if !ok {
+				return fmt.Errorf("component %s uses undeclared event %s", component.Name, name)
+			}
+			builder.addEvent(name, declaration.Kind == "CONTROLLABLE", declaration.Observable != "false")
+			return nil
+		}
+
+		for _, node := range component.Graph.Nodes {
+			state := builder.addState(node.Name)
+			state.Initial = boolString(isTrue(node.Initial))
+			state.Marked = boolString(!hasAccepting)
+			if node.Marking != nil {
+				for _, proposition := range node.Marking.Identifiers {
+					if proposition.Name == supremicaAccepting {
+						state.Marked = "True"
+					}
+				}
+			}
+		}
+
+		if component.Graph.Blocked != nil {
+			for _, identifier := range component.Graph.Blocked.Identifiers {
+				if err := addEvent(identifier.Name); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, edge := range component.Graph.Edges {
+			for _, identifier := range edge.Labels.Identifiers {
+				if err := addEvent(identifier.Name); err != nil {
+					return nil, err
+				}
+				if err := builder.addTransition(edge.Source, identifier.Name, edge.Target); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		models = append(models, builder.model)
+	}
+
+	return models, nil
+}
+
+func writeSupremicaModule(w io.Writer, models []Model) error {
+	module := supremicaModule{
+		Xmlns:  "http://waters.sourceforge.net/xsd/module",
+		XmlnsB: "http://waters.sourceforge.net/xsd/base",
+		Name:   "supervisors",
+	}
+
+	declared := make(map[string]bool)
+	for _, model := range models {
+		stateNames, eventNames := model.Data.labels()
+		component := supremicaComponent{Kind: "SUPERVISOR", Name: model.ID}
+
+		for _, e := range model.Data.Events {
+			if !declared[e.Name] {
+				declared[e.Name] = true
+				declaration := supremicaEventDecl{Kind: "UNCONTROLLABLE", Name: e.Name}
+				if isTrue(e.Controllable) {
+					declaration.Kind = "CONTROLLABLE"
+				}
+				if e.Observable != "" && !isTrue(e.Observable) {
+					declaration.Observable = "false"
+				}
+				module.Events = append(module.Events, declaration)
+			}
+		}
+
+		for _, s := range model.Data.States {
+			node := supremicaNode{Name: stateNames[s.ID]}
+			if isTrue(s.Initial) {
+				node.Initial = "true"
+			}
+			if isTrue(s.Marked) {
+				node.Marking = &supremicaLabelBlock{Identifiers: []supremicaIdentifier{{Name: supremicaAccepting}}}
+			}
+			component.Graph.Nodes = append(component.Graph.Nodes, node)
+		}
+
+		used := make(map[string]bool)
+		for _, t := range model.Data.Transitions {
+			used[t.Event] = true
+			component.Graph.Edges = append(component.Graph.Edges, supremicaEdge{
+				Source: stateNames[t.Source],
+				Target: stateNames[t.Target],
+				Labels: supremicaLabelBlock{Identifiers: []supremicaIdentifier{{Name: eventNames[t.Event]}}},
+			})
+		}
+
+		// events of the alphabet without any transition are blocked everywhere
+		for _, e := range model.Data.Events {
+			if !used[e.ID] {
+				if component.Graph.Blocked == nil {
+					component.Graph.Blocked = &supremicaLabelBlock{}
+				}
+				component.Graph.Blocked.Identifiers = append(component.Graph.Blocked.Identifiers, supremicaIdentifier{Name: e.Name})
+			}
+		}
+
+		module.Components = append(module.Components, component)
+	}
+	module.Events = append(module.Events, supremicaEventDecl{Kind: "PROPOSITION", Name: supremicaAccepting})
+
+	return writeIndentedXML(w, module)
+}
+
+func parseSupremicaProject(content io.Reader) ([]Model, error) {
+	var project supremicaProject
+	decoder := xml.NewDecoder(content)
+	decoder.CharsetReader = charsetReader
+	if err := decoder.Decode(&project); err != nil {
+		return nil, fmt.Errorf("failed to decode Supremica project: %v", err)
+	}
+
+	models := make([]Model, 0, len(project.Automata))
+	for _, automaton := range project.Automata {
+		model := Model{Version: "0.0", Type: "FSA", ID: automaton.Name}
+
+		for _, e := range automaton.Events {
+			// Supremica events are controllable and observable unless stated otherwise
+			model.Data.Events = append(model.Data.Events, Event{
+				ID:           e.ID,
+				Name:         e.Label,
+				Controllable: boolString(e.Controllable != "false"),
+				Observable:   boolString(e.Observable != "false"),
+			})
+		}
+
+		for _, s := range automaton.States {
+			model.Data.States = append(model.Data.States, State{
+				ID:      s.ID,
+				Name:    s.Name,
+				Initial: boolString(isTrue(s.Initial)),
+				Marked:  boolString(isTrue(s.Accepting)),
+			})
+		}
+
+		for _, t := range automaton.Transitions {
+			model.Data.Transitions = append(model.Data.Transitions, Transition{Source: t.Source, Target: t.Dest, Event: t.Event})
+		}
+
+		models = append(models, model)
+	}
+
+	return models, nil
+}
+
+func writeSupremicaProject(w io.Writer, models []Model) error {
+	project := supremicaProject{Name: "supervisors", Major: "0", Minor: "9"}
+
+	for _, model := range models {
+		automaton := supremicaAutomaton{Name: model.ID, Type: "Supervisor"}
+		stateNames, _ := model.Data.labels()
+
+		eventIds := make(map[string]string)
+		for i, e := range model.Data.Events {
+			eventIds[e.ID] = strconv.Itoa(i)
+			event := supremicaEvent{ID: eventIds[e.ID], Label: e.Name}
+			if !isTrue(e.Controllable) {
+				event.Controllable = "false"
+			}
+			if e.Observable != "" && !isTrue(e.Observable) {
+				event.Observable = "false"
+			}
+			automaton.Events = append(automaton.Events, event)
+		}
+
+		stateIds := make(map[string]string)
+		for i, s := range model.Data.States {
+			stateIds[s.ID] = strconv.Itoa(i)
+			state := supremicaState{ID: stateIds[s.ID], Name: stateNames[s.ID]}
+			if isTrue(s.Initial) {
+				state.Initial = "true"
+			}
+			if isTrue(s.Marked) {
+				state.Accepting = "true"
+			}
+			automaton.States = append(automaton.States, state)
+		}
+
+		for _, t := range model.Data.Transitions {
+			automaton.Transitions = append(automaton.Transitions, supremicaTransition{Source: stateIds[t.Source], Dest: stateIds[t.Target], Event: eventIds[t.Event]})
+		}
+
+		project.Automata = append(project.Automata, automaton)
+	}
+
+	return writeIndentedXML(w, project)
+}
+
+func writeIndentedXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode XML: %v", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -9,6 +9,9 @@ import (
 // Structs to represent the XML structure
 type Model struct {
 	XMLName xml.Name `xml:"model"`
+	Version string   `xml:"version,attr,omitempty"`
+	Type    string   `xml:"type,attr,omitempty"`
+	ID      string   `xml:"id,attr,omitempty"`
 	Data    Data     `xml:"data"`
 }
 
@@ -23,8 +26,8 @@ type State struct {
 	Name    string `xml:"name,attr"`
 	Initial string `xml:"initial,attr"`
 	Marked  string `xml:"marked,attr"`
-	X       string `xml:"x,attr"`
-	Y       string `xml:"y,attr"`
+	X       string `xml:"x,attr,omitempty"`
+	Y       string `xml:"y,attr,omitempty"`
 }
 
 type Event struct {
@@ -40,8 +43,8 @@ type Transition struct {
 	Event  string `xml:"event,attr"`
 }
 
-// Function to parse the XML file
-func parseXML(content io.Reader) (*Model, error) {
+// ParseXML parses a supervisor given in the FSA XML format
+func ParseXML(content io.Reader) (*Model, error) {
 	var model Model
 	decoder := xml.NewDecoder(content)
 	if err := decoder.Decode(&model); err != nil {
@@ -50,3 +53,29 @@ func parseXML(content io.Reader) (*Model, error) {
 
 	return &model, nil
 }
+
+// WriteXML writes a supervisor in the FSA XML format
+func WriteXML(w io.Writer, model Model) error {
+	if model.Version == "" {
+		model.Version = "0.0"
+	}
+	if model.Type == "" {
+		model.Type = "FSA"
+	}
+	if model.ID == "" {
+		model.ID = "Untitled"
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "\t")
+	if err := encoder.Encode(model); err != nil {
+		return fmt.Errorf("failed to encode XML: %v", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,131 @@
+package sunspec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	readHoldingRegisters = 0x03
+	// maximum number of registers of a read request
+	maxQuantity = 125
+)
+
+// ModbusError is a Modbus exception response.
+type ModbusError struct {
+	FunctionCode  byte
+	ExceptionCode byte
+}
+
+func (e *ModbusError) Error() string {
+	return fmt.Sprintf("modbus exception %d for function %d", e.ExceptionCode, e.FunctionCode)
+}
+
+// modbusClient is a Modbus TCP client.
+type modbusClient struct {
+	conn          net.Conn
+	unitId        byte
+	timeout       time.Duration
+	mu            sync.Mutex
+	transactionId uint16
+}
+
+func dialModbus(address string, unitId byte, timeout time.Duration) (*modbusClient, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &modbusClient{conn: conn, unitId: unitId, timeout: timeout}, nil
+}
+
+func (c *modbusClient) close() error {
+	return c.conn.Close()
+}
+
+// readHoldingRegisters reads quantity registers starting at address.
+func (c *modbusClient) readHoldingRegisters(address uint16, quantity uint16) ([]uint16, error) {
+	if quantity == 0 || quantity > maxQuantity {
+		return nil, fmt.Errorf("invalid quantity %d", quantity)
+	}
+
+	pdu := make([]byte, 5)
+	pdu[0] = readHoldingRegisters
+	binary.BigEndian.PutUint16(pdu[1:], address)
+	binary.BigEndian.PutUint16(pdu[3:], quantity)
+
+	response, err := c.request(pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) < 2 || int(response[1]) != 2*int(quantity) || len(response) != 2+2*int(quantity) {
+		return nil, fmt.Errorf("invalid response length %d for %d registers", len(response), quantity)
+	}
+
+	registers := make([]uint16, quantity)
+	for i := range registers {
+		registers[i] = binary.BigEndian.Uint16(response[2+2*i:])
+	}
+
+	return registers, nil
+}
+
+// request sends a PDU and returns the response PDU.
+func (c *modbusClient) request(pdu []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.transactionId++
+
+	// MBAP header: transaction id, protocol id 0, length of unit id and PDU
+	frame := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], c.transactionId)
+	binary.BigEndian.PutUint16(frame[2:], 0)
+	binary.BigEndian.PutUint16(frame[4:], uint16(1+len(pdu)))
+	frame[6] = c.unitId
+	copy(frame[7:], pdu)
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid length %d", length)
+	}
+
+	response := make([]byte, length-1)
+	if _, err := io.ReadFull(c.conn, response); err != nil {
+		return nil, err
+	}
+
+	if transactionId := binary.BigEndian.Uint16(header[0:]); transactionId != c.transactionId {
+		return nil, fmt.Errorf("unexpected transaction id %d, expected %d", transactionId, c.transactionId)
+	}
+
+	if response[0] == pdu[0]|0x80 {
+		if len(response) < 2 {
+			return nil, fmt.Errorf("exception response of function %d without exception code", pdu[0])
+		}
+		return nil, &ModbusError{FunctionCode: pdu[0], ExceptionCode: response[1]}
+	}
+	if response[0] != pdu[0] {
+		return nil, fmt.Errorf("unexpected function code %d", response[0])
+	}
+
+	return response, nil
+}
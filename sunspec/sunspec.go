@@ -0,0 +1,179 @@
+package sunspec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+// SunSpec searches the "SunS" marker at these register addresses
+var baseAddresses = []uint16{40000, 0, 50000}
+
+const (
+	markerHigh = 0x5375 // "Su"
+	markerLow  = 0x6e53 // "nS"
+	endModelId = 0xffff
+
+	// offsets of AC power and its scale factor in the data of the integer
+	// inverter models 101 to 103
+	wOffset   = 12
+	wSfOffset = 13
+)
+
+// inverter models with single, split and three phase
+var inverterModels = []uint16{101, 102, 103}
+
+var errNotImplemented = errors.New("value not implemented")
+
+// Reader polls the AC power of a SunSpec inverter over Modbus TCP.
+type Reader struct {
+	config common.SunSpecConfig
+	client *modbusClient
+	// powerAddress is the address of W in the inverter model
+	powerAddress uint16
+}
+
+func NewReader(config common.SunSpecConfig) *Reader {
+	return &Reader{config: config}
+}
+
+// Open connects to the inverter and discovers its SunSpec model chain.
+func (r *Reader) Open() error {
+	client, err := dialModbus(r.config.Address, r.config.UnitId, r.config.Timeout)
+	if err != nil {
+		return err
+	}
+
+	powerAddress, err := discover(client)
+	if err != nil {
+		client.close()
+		return err
+	}
+
+	r.client = client
+	r.powerAddress = powerAddress
+
+	return nil
+}
+
+func (r *Reader) Close() {
+	if r.client != nil {
+		r.client.close()
+		r.client = nil
+	}
+}
+
+// discover walks the model chain and returns the address of W of the first
+// inverter model.
+func discover(client *modbusClient) (uint16, error) {
+	for _, base := range baseAddresses {
+		marker, err := client.readHoldingRegisters(base, 2)
+		if err != nil {
+			var modbusErr *ModbusError
+			if errors.As(err, &modbusErr) {
+				continue
+			}
+			return 0, err
+		}
+		if marker[0] != markerHigh || marker[1] != markerLow {
+			continue
+		}
+
+		address := base + 2
+		for {
+			header, err := client.readHoldingRegisters(address, 2)
+			if err != nil {
+				return 0, err
+			}
+
+			id, length := header[0], header[1]
+			if id == endModelId {
+				return 0, fmt.Errorf("no inverter model found at base address %d", base)
+			}
+
+			log.Printf("sunspec - found model %d at %d", id, address)
+			if slices.Contains(inverterModels, id) {
+				if length <= wSfOffset {
+					return 0, fmt.Errorf("inverter model %d too short: %d", id, length)
+				}
+				return address + 2 + wOffset, nil
+			}
+
+			next := int(address) + 2 + int(length)
+			if next > math.MaxUint16-2 {
+				return 0, fmt.Errorf("model chain exceeds the register space at %d", address)
+			}
+			address = uint16(next)
+		}
+	}
+
+	return 0, errors.New("no SunSpec device found")
+}
+
+// ReadPower reads the AC power in W.
+func (r *Reader) ReadPower() (float64, error) {
+	if r.client == nil {
+		if err := r.Open(); err != nil {
+			return 0, err
+		}
+	}
+
+	registers, err := r.client.readHoldingRegisters(r.powerAddress, 2)
+	if err != nil {
+		// connect and discover again on the next read
+		r.Close()
+		return 0, err
+	}
+
+	return scale(registers[0], registers[1])
+}
+
+// scale applies a SunSpec scale factor to an int16 value.
+func scale(value uint16, scaleFactor uint16) (float64, error) {
+	if value == 0x8000 || scaleFactor == 0x8000 {
+		return 0, errNotImplemented
+	}
+
+	return float64(int16(value)) * math.Pow10(int(int16(scaleFactor))), nil
+}
+
+// SubscribeToPvProduction polls the AC power every PollInterval until ctx is
+// done, the connection is closed then. Failed reads are logged and retried
+// with a new connection.
+func (r *Reader) SubscribeToPvProduction(ctx context.Context) (<-chan float64, error) {
+	productionChannel := make(chan float64)
+
+	go func() {
+		defer close(productionChannel)
+		defer r.Close()
+
+		ticker := time.NewTicker(r.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			if power, err := r.ReadPower(); err != nil {
+				log.Printf("sunspec - could not read AC power: %s", err)
+			} else {
+				select {
+				case productionChannel <- power:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return productionChannel, nil
+}
@@ -0,0 +1,191 @@
+package sunspec
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"code.siemens.com/energy-community-controller/common"
+)
+
+// testServer is a Modbus TCP server stub serving holding registers. Reads of
+// registers which are not set are answered with exception 2 (illegal data
+// address).
+type testServer struct {
+	listener  net.Listener
+	registers map[uint16]uint16
+	// truncated exception responses lack the exception code
+	truncated bool
+}
+
+func newTestServer(t *testing.T, registers map[uint16]uint16) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := testServer{listener: listener, registers: registers}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return &s
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		header := make([]byte, 7)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		response := s.handle(pdu)
+		if s.truncated && response[0]&0x80 != 0 {
+			response = response[:1]
+		}
+		binary.BigEndian.PutUint16(header[4:], uint16(1+len(response)))
+		conn.Write(append(header, response...))
+	}
+}
+
+func (s *testServer) handle(pdu []byte) []byte {
+	if pdu[0] != readHoldingRegisters {
+		return []byte{pdu[0] | 0x80, 1}
+	}
+
+	address := binary.BigEndian.Uint16(pdu[1:])
+	quantity := binary.BigEndian.Uint16(pdu[3:])
+
+	response := []byte{pdu[0], byte(2 * quantity)}
+	for i := uint16(0); i < quantity; i++ {
+		value, ok := s.registers[address+i]
+		if !ok {
+			return []byte{pdu[0] | 0x80, 2}
+		}
+		response = binary.BigEndian.AppendUint16(response, value)
+	}
+
+	return response
+}
+
+// sunSpecRegisters returns a model chain with a common model and a three
+// phase inverter model at base.
+func sunSpecRegisters(base uint16, w uint16, wSf int16) map[uint16]uint16 {
+	registers := map[uint16]uint16{base: markerHigh, base + 1: markerLow}
+
+	address := base + 2
+	addModel := func(id uint16, length uint16, data map[uint16]uint16) {
+		registers[address] = id
+		registers[address+1] = length
+		for i := uint16(0); i < length; i++ {
+			registers[address+2+i] = data[i]
+		}
+		address += 2 + length
+	}
+
+	addModel(1, 66, nil)
+	addModel(103, 50, map[uint16]uint16{wOffset: w, wSfOffset: uint16(wSf)})
+	registers[address] = endModelId
+	registers[address+1] = 0
+
+	return registers
+}
+
+func testConfig(address string) common.SunSpecConfig {
+	config := common.NewConfig().SunSpec
+	config.Address = address
+	config.PollInterval = 10 * time.Millisecond
+	config.Timeout = time.Second
+	return config
+}
+
+func TestReadPower(t *testing.T) {
+	server := newTestServer(t, sunSpecRegisters(40000, 12345, -1))
+	defer server.listener.Close()
+
+	reader := NewReader(testConfig(server.listener.Addr().String()))
+	if err := reader.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if reader.powerAddress != 40000+2+68+2+wOffset {
+		t.Errorf("Wrong power address: %d", reader.powerAddress)
+	}
+
+	power, err := reader.ReadPower()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if power != 1234.5 {
+		t.Errorf("Wrong power: %f", power)
+	}
+}
+
+func TestDiscoverAlternativeBaseAddress(t *testing.T) {
+	server := newTestServer(t, sunSpecRegisters(0, 0xfffe, 2))
+	defer server.listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	productionChannel, err := NewReader(testConfig(server.listener.Addr().String())).SubscribeToPvProduction(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case power := <-productionChannel:
+		if power != -200 {
+			t.Errorf("Wrong power: %f", power)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No production polled")
+	}
+}
+
+func TestNoSunSpecDevice(t *testing.T) {
+	server := newTestServer(t, map[uint16]uint16{40000: 1, 40001: 2})
+	defer server.listener.Close()
+
+	if err := NewReader(testConfig(server.listener.Addr().String())).Open(); err == nil {
+		t.Errorf("Missing SunSpec marker not detected")
+	}
+}
+
+func TestTruncatedException(t *testing.T) {
+	server := newTestServer(t, map[uint16]uint16{})
+	server.truncated = true
+	defer server.listener.Close()
+
+	client, err := dialModbus(server.listener.Addr().String(), 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+
+	if _, err := client.readHoldingRegisters(40000, 2); err == nil {
+		t.Errorf("Truncated exception response not detected")
+	}
+}
+
+func TestScaleNotImplemented(t *testing.T) {
+	if _, err := scale(0x8000, 0); err != errNotImplemented {
+		t.Errorf("Not implemented value not detected: %v", err)
+	}
+}